@@ -0,0 +1,392 @@
+package checker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/expression"
+	"github.com/Tinchocw/forky/common/statement"
+	"github.com/Tinchocw/forky/common/statement/assignment"
+	"github.com/Tinchocw/forky/common/statement/block"
+	"github.com/Tinchocw/forky/common/statement/declaration"
+	"github.com/Tinchocw/forky/common/statement/extra"
+	"github.com/Tinchocw/forky/common/statement/flow"
+	"github.com/Tinchocw/forky/common/statement/function"
+)
+
+// forkSet holds the forks whose index a value depends on.
+type forkSet map[*fork]bool
+
+func (s forkSet) union(other forkSet) forkSet {
+	if len(other) == 0 {
+		return s
+	}
+	union := forkSet{}
+	for f := range s {
+		union[f] = true
+	}
+	for f := range other {
+		union[f] = true
+	}
+	return union
+}
+
+type scope struct {
+	// names maps the names declared in the scope to the forks whose index
+	// their value depends on.
+	names map[string]forkSet
+	// functions holds the bodies of the functions defined in the scope,
+	// checked when the scope ends as the resolver does.
+	functions []func()
+}
+
+type set struct {
+	branch   int
+	position common.Position
+}
+
+// fork gathers what the branches of a fork being checked set outside of it.
+type fork struct {
+	position common.Position
+	array    bool
+	index    *string
+	// base is the first scope belonging to the branches. Names declared in
+	// scopes below it are shared by every branch.
+	base   int
+	branch int
+	// locked counts the lock and atomic blocks the branch is running in.
+	locked int
+	sets   map[string][]set
+	names  []string
+	cells  map[string]bool
+}
+
+// check is the state of a single walk over a program.
+type check struct {
+	scopes   []*scope
+	forks    []*fork
+	warnings []Warning
+}
+
+type Checker struct {
+	debug bool
+}
+
+func CreateChecker(debug bool) *Checker {
+	return &Checker{debug: debug}
+}
+
+// Check looks for fork branches that are likely to race with each other:
+// branches setting a variable declared outside the fork, and branches of a
+// fork over an array setting cells at indexes that do not depend on the
+// fork index. Updates made within lock and atomic blocks are left alone.
+// Only the code written inside a fork is checked; functions defined
+// elsewhere and called from a branch are not.
+func (c *Checker) Check(program statement.Program) []Warning {
+	ch := &check{}
+	ch.beginScope()
+	ch.statements(program.Statements)
+	ch.endScope()
+
+	sort.SliceStable(ch.warnings, func(i, j int) bool {
+		return ch.warnings[i].Position.Offset < ch.warnings[j].Position.Offset
+	})
+
+	if c.debug {
+		fmt.Printf("[DEBUG] Checked forks with %d warnings\n", len(ch.warnings))
+	}
+
+	return ch.warnings
+}
+
+func (c *check) warnf(pos common.Position, format string, args ...any) {
+	c.warnings = append(c.warnings, Warning{Position: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *check) beginScope() {
+	c.scopes = append(c.scopes, &scope{names: map[string]forkSet{}})
+}
+
+func (c *check) endScope() {
+	current := c.scopes[len(c.scopes)-1]
+	for _, body := range current.functions {
+		body()
+	}
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *check) declare(name string, dependent forkSet) {
+	c.scopes[len(c.scopes)-1].names[name] = dependent
+}
+
+// lookup returns the scope declaring name, or -1 for the globals of
+// previous programs, and the forks whose index its value depends on.
+func (c *check) lookup(name string) (int, forkSet) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if dependent, ok := c.scopes[i].names[name]; ok {
+			return i, dependent
+		}
+	}
+	return -1, nil
+}
+
+// shared returns the innermost fork when name is declared outside of it.
+func (c *check) shared(level int) *fork {
+	if len(c.forks) == 0 {
+		return nil
+	}
+	f := c.forks[len(c.forks)-1]
+	if level >= f.base {
+		return nil
+	}
+	return f
+}
+
+func (c *check) set(name string, dependent forkSet, pos common.Position) {
+	level, previous := c.lookup(name)
+	f := c.shared(level)
+	if f == nil {
+		if level >= 0 {
+			c.scopes[level].names[name] = previous.union(dependent)
+		}
+		return
+	}
+	if f.locked > 0 {
+		return
+	}
+	if _, ok := f.sets[name]; !ok {
+		f.names = append(f.names, name)
+	}
+	f.sets[name] = append(f.sets[name], set{branch: f.branch, position: pos})
+}
+
+// setCell checks a cell of name set at an index depending on the index of
+// the forks in dependent. Every fork over an array that name is declared
+// outside of needs its own index in there: in a nested fork, the index of
+// the outer fork alone tells apart the cells of the outer branches but not
+// those of the inner ones.
+func (c *check) setCell(name string, dependent forkSet, pos common.Position) {
+	level, _ := c.lookup(name)
+	// A lock taken in a branch is held by the branches of the forks it runs
+	// too, so it keeps those from racing with the branches of the outer forks.
+	locked := false
+	for i := len(c.forks) - 1; i >= 0; i-- {
+		f := c.forks[i]
+		locked = locked || f.locked > 0
+		if level >= f.base || locked || !f.array || dependent[f] || f.cells[name] {
+			continue
+		}
+		f.cells[name] = true
+
+		if f.index == nil {
+			c.warnf(pos, "every branch of the fork at %s sets cells of '%s' without a fork index to tell them apart", f.position, name)
+			continue
+		}
+		c.warnf(pos, "every branch of the fork at %s sets '%s' at an index that does not depend on '%s'", f.position, name, *f.index)
+	}
+}
+
+func (c *check) beginFork(pos common.Position, array bool, index *string) *fork {
+	f := &fork{
+		position: pos,
+		array:    array,
+		index:    index,
+		base:     len(c.scopes),
+		sets:     map[string][]set{},
+		cells:    map[string]bool{},
+	}
+	c.forks = append(c.forks, f)
+	return f
+}
+
+func (c *check) endFork() {
+	f := c.forks[len(c.forks)-1]
+	c.forks = c.forks[:len(c.forks)-1]
+
+	for _, name := range f.names {
+		sets := f.sets[name]
+		if f.array {
+			c.warnf(sets[0].position, "every branch of the fork at %s sets '%s', declared outside the fork", f.position, name)
+			continue
+		}
+
+		var branches []string
+		for i, s := range sets {
+			if i == 0 || s.branch != sets[i-1].branch {
+				branches = append(branches, fmt.Sprint(s.branch))
+			}
+		}
+		if len(branches) == 1 {
+			c.warnf(sets[0].position, "branch %s of the fork at %s sets '%s', declared outside the fork", branches[0], f.position, name)
+			continue
+		}
+		last := len(branches) - 1
+		c.warnf(sets[0].position, "branches %s and %s of the fork at %s all set '%s', declared outside the fork",
+			strings.Join(branches[:last], ", "), branches[last], f.position, name)
+	}
+}
+
+func (c *check) forkArray(array expression.Expression, indexName *string, elemName *string, body *block.BlockStatement, pos common.Position) {
+	c.expression(array)
+	f := c.beginFork(pos, true, indexName)
+	c.beginScope()
+	if indexName != nil {
+		c.declare(*indexName, forkSet{f: true})
+	}
+	if elemName != nil {
+		c.declare(*elemName, nil)
+	}
+	c.block(body)
+	c.endScope()
+	c.endFork()
+}
+
+func (c *check) function(parameters []string, body []statement.Statement) {
+	current := c.scopes[len(c.scopes)-1]
+	current.functions = append(current.functions, func() {
+		c.beginScope()
+		for _, parameter := range parameters {
+			c.declare(parameter, nil)
+		}
+		c.statements(body)
+		c.endScope()
+	})
+}
+
+func (c *check) statements(statements []statement.Statement) {
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+}
+
+func (c *check) block(b *block.BlockStatement) {
+	c.beginScope()
+	c.statements(b.Statements)
+	c.endScope()
+}
+
+func (c *check) statement(stmt statement.Statement) {
+	switch s := stmt.(type) {
+	case *block.BlockStatement:
+		c.block(s)
+	case *declaration.VarDeclaration:
+		c.declare(s.Name, c.expression(s.Value))
+	case *declaration.ArrayDeclaration:
+		c.expressions(s.Lengths)
+		c.expression(s.Value)
+		c.declare(s.Name, nil)
+	case *assignment.VarAssignment:
+		c.set(s.Name, c.expression(s.Value), s.Position)
+	case *assignment.ArrayAssignment:
+		dependent := c.expressions(s.Indexes)
+		c.expression(s.Value)
+		c.setCell(s.Name, dependent, s.Position)
+	case *extra.PrintStatement:
+		c.expression(s.Value)
+	case *extra.ForkBlockStatement:
+		f := c.beginFork(s.Position, false, nil)
+		for i, branch := range s.Block.Statements {
+			f.branch = i
+			c.beginScope()
+			c.statement(branch)
+			c.endScope()
+		}
+		c.endFork()
+	case *extra.ForkArrayStatement:
+		c.forkArray(s.Array, s.IndexName, s.ElemName, s.Block, s.Position)
+	case *extra.LockStatement:
+		if len(c.forks) == 0 {
+			c.block(s.Block)
+			break
+		}
+		f := c.forks[len(c.forks)-1]
+		f.locked++
+		c.block(s.Block)
+		f.locked--
+	case *extra.SelectStatement:
+		for _, sc := range s.Cases {
+			c.expression(sc.Channel)
+			c.expression(sc.Value)
+			c.beginScope()
+			if sc.Name != nil {
+				c.declare(*sc.Name, nil)
+			}
+			c.statements(sc.Body.Statements)
+			c.endScope()
+		}
+		if s.Default != nil {
+			c.block(s.Default)
+		}
+	case *flow.IfStatement:
+		c.expression(s.Condition)
+		c.block(s.Body)
+		for elseIf := s.ElseIf; elseIf != nil; elseIf = elseIf.ElseIf {
+			c.expression(elseIf.Condition)
+			c.block(elseIf.Body)
+		}
+		if s.Else != nil {
+			c.block(s.Else.Body)
+		}
+	case *flow.WhileStatement:
+		c.expression(s.Condition)
+		c.block(s.Body)
+	case *function.FunctionDef:
+		c.declare(*s.Name, nil)
+		c.function(s.Parameters, s.Body.Statements)
+	case *function.ReturnStatement:
+		c.expression(s.Value)
+	case *statement.ExpressionStatement:
+		c.expression(s.Expression)
+	}
+}
+
+func (c *check) expressions(exprs []expression.Expression) forkSet {
+	var dependent forkSet
+	for _, expr := range exprs {
+		dependent = dependent.union(c.expression(expr))
+	}
+	return dependent
+}
+
+// expression walks expr and returns the forks whose index it depends on.
+func (c *check) expression(expr expression.Expression) forkSet {
+	switch e := expr.(type) {
+	case *expression.LogicalOrNode:
+		return c.expressions([]expression.Expression{e.Left, e.Right})
+	case *expression.LogicalAndNode:
+		return c.expressions([]expression.Expression{e.Left, e.Right})
+	case *expression.EqualityNode:
+		return c.expressions([]expression.Expression{e.Left, e.Right})
+	case *expression.ComparisonNode:
+		return c.expressions([]expression.Expression{e.Left, e.Right})
+	case *expression.TermNode:
+		return c.expressions([]expression.Expression{e.Left, e.Right})
+	case *expression.FactorNode:
+		return c.expressions([]expression.Expression{e.Left, e.Right})
+	case *expression.UnaryNode:
+		return c.expression(e.Right)
+	case *expression.ArrayAccessNode:
+		return c.expressions([]expression.Expression{e.Left, e.Index})
+	case *expression.FunctionCallNode:
+		callee := c.expression(e.Callee)
+		return callee.union(c.expressions(e.Arguments))
+	case *expression.TokenLiteralNode:
+		if e.Token.Typ == common.IDENTIFIER {
+			_, dependent := c.lookup(e.Token.Value)
+			return dependent
+		}
+	case *expression.GroupingExpressionNode:
+		return c.expression(e.Expression)
+	case *expression.ArrayLiteralNode:
+		return c.expressions(e.Elements)
+	case *expression.FunctionLiteralNode:
+		c.function(e.Parameters, e.Body.Statements)
+	case *expression.ForkExpressionNode:
+		c.forkArray(e.Array, e.IndexName, e.ElemName, e.Body, e.Position)
+	case *expression.ForkReduceNode:
+		return c.expressions([]expression.Expression{e.Array, e.Identity, e.Combine})
+	}
+	return nil
+}
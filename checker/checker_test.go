@@ -0,0 +1,96 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Tinchocw/forky/parser"
+	"github.com/Tinchocw/forky/scanner"
+)
+
+func checkSource(t *testing.T, source string) []Warning {
+	t.Helper()
+	sc := scanner.CreateForkyScanner(1, false)
+	tokens, err := sc.Scan(strings.NewReader(source), int64(len(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := parser.CreateForkyParser(1, false)
+	program, err := ps.Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CreateChecker(false).Check(program)
+}
+
+func TestForkWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		warnings []string
+	}{
+		{
+			name:     "outer variable set by a fork array",
+			source:   `var total = 0; fork [1, 2] e { set total = total + e; }`,
+			warnings: []string{"1:36: every branch of the fork at 1:16 sets 'total', declared outside the fork"},
+		},
+		{
+			name:     "outer variable set by sibling blocks",
+			source:   `var x = 0; fork { { set x = 1; } { set x = 2; } { print(x); } }`,
+			warnings: []string{"1:25: branches 0 and 1 of the fork at 1:12 all set 'x', declared outside the fork"},
+		},
+		{
+			name:     "outer variable set by one block",
+			source:   `var x = 0; fork { { set x = 1; } { print(1); } }`,
+			warnings: []string{"1:25: branch 0 of the fork at 1:12 sets 'x', declared outside the fork"},
+		},
+		{
+			name:     "cell index without the fork index",
+			source:   `var cells[2] = 0; fork [1, 2] i, e { set cells[e] = i; }`,
+			warnings: []string{"1:42: every branch of the fork at 1:19 sets 'cells' at an index that does not depend on 'i'"},
+		},
+		{
+			name:   "cell index derived from the fork index",
+			source: `var grid[2][2] = 0; fork [1, 2, 3, 4] i, e { var row = i / 2; set grid[row][i - row * 2] = e; }`,
+		},
+		{
+			name:     "nested fork cell index with only the outer fork index",
+			source:   `var out[2] = 0; fork [1, 2] i, e { fork [1, 2] j, f { set out[i] = f; } }`,
+			warnings: []string{"1:59: every branch of the fork at 1:36 sets 'out' at an index that does not depend on 'j'"},
+		},
+		{
+			name:     "nested fork cell index with only the inner fork index",
+			source:   `var out[2] = 0; fork [1, 2] i, e { fork [1, 2] j, f { set out[j] = f; } }`,
+			warnings: []string{"1:59: every branch of the fork at 1:17 sets 'out' at an index that does not depend on 'i'"},
+		},
+		{
+			name:   "nested fork cell indexes with both fork indexes",
+			source: `var grid[2][2] = 0; fork [1, 2] i, e { var row = i; fork [1, 2] j, f { set grid[row][j] = e * f; } }`,
+		},
+		{
+			name:   "nested fork cells of a branch local",
+			source: `fork [1, 2] i, e { var row[2] = 0; fork [1, 2] j, f { set row[j] = i; } }`,
+		},
+		{
+			name:   "updates under a lock",
+			source: `var total = 0; var cells[1] = 0; fork [1, 2] e { atomic { set total = total + e; } lock c { set cells[0] = e; } }`,
+		},
+		{
+			name:   "branch locals",
+			source: `fork [1, 2] e { var x = e; set x = x * 2; } fork { { var y = 0; set y = 1; } }`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings := checkSource(t, test.source)
+			got := make([]string, len(warnings))
+			for i, warning := range warnings {
+				got[i] = warning.String()
+			}
+			if strings.Join(got, "\n") != strings.Join(test.warnings, "\n") {
+				t.Errorf("got warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(test.warnings, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+// Warning is a likely mistake located in the checked source. Unlike
+// errors, warnings do not stop the program from running.
+type Warning struct {
+	Position common.Position
+	Message  string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Position, w.Message)
+}
+
+func PrintWarnings(warnings []Warning) {
+	for _, warning := range warnings {
+		fmt.Println(common.Colorize("WARNING: "+warning.String(), common.COLOR_YELLOW))
+	}
+}
@@ -9,6 +9,7 @@ import (
 type ArrayAccessNode struct {
 	Left  Expression
 	Index Expression
+	Span  common.Span
 }
 
 func (aa *ArrayAccessNode) Print(start string) {
@@ -9,6 +9,7 @@ import (
 type FunctionCallNode struct {
 	Callee    Expression
 	Arguments []Expression
+	Span      common.Span
 }
 
 func (fc FunctionCallNode) Print(start string) {
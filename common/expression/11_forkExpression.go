@@ -0,0 +1,39 @@
+package expression
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/statement/block"
+)
+
+// ForkExpressionNode runs Body for every element of Array in parallel, as a
+// fork array statement does, and evaluates to the array of the values each
+// branch returns, in index order.
+type ForkExpressionNode struct {
+	Array     Expression
+	IndexName *string
+	ElemName  *string
+	Body      *block.BlockStatement
+	Position  common.Position
+}
+
+func (fe ForkExpressionNode) Print(start string) {
+	nodeName := "Fork Expression"
+	fmt.Printf("%s%s\n", start, common.Colorize(nodeName, common.COLOR_GREEN))
+	start = common.AdvanceSuffix(start)
+
+	fmt.Printf("%s%s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Array:", common.COLOR_YELLOW))
+	fe.Array.Print(start + string(common.SIMPLE_CONNECTOR) + string(common.LAST_CONNECTOR))
+
+	if fe.IndexName != nil {
+		fmt.Printf("%s%s %s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Index Name:", common.COLOR_YELLOW), common.Colorize(*fe.IndexName, common.COLOR_WHITE))
+	}
+
+	if fe.ElemName != nil {
+		fmt.Printf("%s%s %s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Elem Name:", common.COLOR_YELLOW), common.Colorize(*fe.ElemName, common.COLOR_WHITE))
+	}
+
+	fmt.Printf("%s%s\n", start+string(common.LAST_CONNECTOR), common.Colorize("Body:", common.COLOR_YELLOW))
+	fe.Body.Print(start + string(common.SIMPLE_INDENT))
+}
@@ -0,0 +1,32 @@
+package expression
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+// ForkReduceNode combines the elements of Array into a single value with
+// Combine, splitting the array in halves reduced in parallel. Identity is the
+// result for an empty array.
+type ForkReduceNode struct {
+	Array    Expression
+	Identity Expression
+	Combine  Expression
+	Position common.Position
+}
+
+func (fr ForkReduceNode) Print(start string) {
+	nodeName := "Fork Reduce"
+	fmt.Printf("%s%s\n", start, common.Colorize(nodeName, common.COLOR_GREEN))
+	start = common.AdvanceSuffix(start)
+
+	fmt.Printf("%s%s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Array:", common.COLOR_YELLOW))
+	fr.Array.Print(start + string(common.SIMPLE_CONNECTOR) + string(common.LAST_CONNECTOR))
+
+	fmt.Printf("%s%s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Identity:", common.COLOR_YELLOW))
+	fr.Identity.Print(start + string(common.SIMPLE_CONNECTOR) + string(common.LAST_CONNECTOR))
+
+	fmt.Printf("%s%s\n", start+string(common.LAST_CONNECTOR), common.Colorize("Combine:", common.COLOR_YELLOW))
+	fr.Combine.Print(start + string(common.SIMPLE_INDENT) + string(common.LAST_CONNECTOR))
+}
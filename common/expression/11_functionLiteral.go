@@ -0,0 +1,36 @@
+package expression
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/statement/block"
+)
+
+type FunctionLiteralNode struct {
+	Parameters []string
+	Body       *block.BlockStatement
+	Position   common.Position
+}
+
+func (fl FunctionLiteralNode) Print(start string) {
+	nodeName := "Function Literal"
+	fmt.Printf("%s%s\n", start, common.Colorize(nodeName, common.COLOR_GREEN))
+	start = common.AdvanceSuffix(start)
+
+	if len(fl.Parameters) > 0 {
+		fmt.Printf("%s%s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Parameters:", common.COLOR_YELLOW))
+		paramsBase := start + string(common.SIMPLE_CONNECTOR)
+		for i, param := range fl.Parameters {
+			conn := string(common.BRANCH_CONNECTOR)
+			if i == len(fl.Parameters)-1 {
+				conn = string(common.LAST_CONNECTOR)
+			}
+
+			fmt.Printf("%s%s %s\n", paramsBase+conn, common.Colorize(fmt.Sprintf("Parameter %d:", i+1), common.COLOR_YELLOW), common.Colorize(param, common.COLOR_WHITE))
+		}
+	}
+
+	fmt.Printf("%s%s\n", start+string(common.LAST_CONNECTOR), common.Colorize("Body:", common.COLOR_YELLOW))
+	fl.Body.Print(start + string(common.SIMPLE_INDENT))
+}
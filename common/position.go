@@ -0,0 +1,60 @@
+package common
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Position locates a point of the source. Line and Column are 1-based (the
+// column counts runes), Offset is the 0-based byte offset.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// Span is the half-open range [Start, End) covered by a token.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// StartPosition returns the position of the first character of a source.
+func StartPosition() Position {
+	return Position{Line: 1, Column: 1, Offset: 0}
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Advance returns the position reached after reading text starting at p.
+func (p Position) Advance(text string) Position {
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		p.Offset += size
+		if r == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
+
+// Rebase translates a position computed relative to the start of a chunk of
+// source into the position it has once that chunk is known to begin at base.
+func (p Position) Rebase(base Position) Position {
+	if p.Line == 1 {
+		p.Column += base.Column - 1
+	}
+	p.Line += base.Line - 1
+	p.Offset += base.Offset
+	return p
+}
+
+func (s Span) Rebase(base Position) Span {
+	return Span{Start: s.Start.Rebase(base), End: s.End.Rebase(base)}
+}
@@ -8,9 +8,10 @@ import (
 )
 
 type ArrayAssignment struct {
-	Name    string
-	Indexes []expression.Expression
-	Value   expression.Expression
+	Name     string
+	Indexes  []expression.Expression
+	Value    expression.Expression
+	Position common.Position
 }
 
 func (aa ArrayAssignment) Print(start string) {
@@ -51,5 +52,9 @@ func (aa ArrayAssignment) Print(start string) {
 }
 
 func (aa ArrayAssignment) Headline() string {
-	return common.Colorize("Array Assignment", common.COLOR_GREEN)
+	return common.Colorize(aa.Kind(), common.COLOR_GREEN)
+}
+
+func (aa ArrayAssignment) Kind() string {
+	return "Array Assignment"
 }
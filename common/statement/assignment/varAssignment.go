@@ -8,8 +8,9 @@ import (
 )
 
 type VarAssignment struct {
-	Name  string
-	Value expression.Expression
+	Name     string
+	Value    expression.Expression
+	Position common.Position
 }
 
 func (a VarAssignment) Print(start string) {
@@ -28,5 +29,9 @@ func (a VarAssignment) Print(start string) {
 }
 
 func (a VarAssignment) Headline() string {
-	return common.Colorize("Var Assignment", common.COLOR_GREEN)
+	return common.Colorize(a.Kind(), common.COLOR_GREEN)
+}
+
+func (a VarAssignment) Kind() string {
+	return "Var Assignment"
 }
@@ -2,17 +2,20 @@ package block
 
 import (
 	"github.com/Tinchocw/forky/common"
-	"github.com/Tinchocw/forky/common/statement"
 )
 
 type BlockStatement struct {
-	Statements []statement.Statement
+	Statements []common.Statement
 }
 
 func (bs BlockStatement) Print(start string) {
-	statement.PrintStatements(start, bs.Statements)
+	common.PrintStatements(start, bs.Statements)
 }
 
 func (bs BlockStatement) Headline() string {
-	return common.Colorize("Block Statement", common.COLOR_MAGENTA)
+	return common.Colorize(bs.Kind(), common.COLOR_MAGENTA)
+}
+
+func (bs BlockStatement) Kind() string {
+	return "Block Statement"
 }
@@ -8,9 +8,10 @@ import (
 )
 
 type ArrayDeclaration struct {
-	Name    string
-	Lengths []expression.Expression
-	Value   expression.Expression
+	Name     string
+	Lengths  []expression.Expression
+	Value    expression.Expression
+	Position common.Position
 }
 
 func (ad ArrayDeclaration) Print(start string) {
@@ -54,5 +55,9 @@ func (ad ArrayDeclaration) Print(start string) {
 }
 
 func (ad ArrayDeclaration) Headline() string {
-	return common.Colorize("Array Declaration", common.COLOR_GREEN)
+	return common.Colorize(ad.Kind(), common.COLOR_GREEN)
+}
+
+func (ad ArrayDeclaration) Kind() string {
+	return "Array Declaration"
 }
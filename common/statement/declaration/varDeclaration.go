@@ -8,8 +8,9 @@ import (
 )
 
 type VarDeclaration struct {
-	Name  string
-	Value expression.Expression
+	Name     string
+	Value    expression.Expression
+	Position common.Position
 }
 
 func (vd VarDeclaration) Print(start string) {
@@ -28,5 +29,9 @@ func (vd VarDeclaration) Print(start string) {
 }
 
 func (vd VarDeclaration) Headline() string {
-	return common.Colorize("Var Declaration", common.COLOR_GREEN)
+	return common.Colorize(vd.Kind(), common.COLOR_GREEN)
+}
+
+func (vd VarDeclaration) Kind() string {
+	return "Var Declaration"
 }
@@ -9,6 +9,7 @@ import (
 
 type ExpressionStatement struct {
 	Expression expression.Expression
+	Position   common.Position
 }
 
 func (es ExpressionStatement) Print(start string) {
@@ -18,5 +19,9 @@ func (es ExpressionStatement) Print(start string) {
 }
 
 func (es ExpressionStatement) Headline() string {
-	return common.Colorize("Expression Statement", common.COLOR_YELLOW)
+	return common.Colorize(es.Kind(), common.COLOR_YELLOW)
+}
+
+func (es ExpressionStatement) Kind() string {
+	return "Expression Statement"
 }
@@ -13,6 +13,7 @@ type ForkArrayStatement struct {
 	IndexName *string
 	ElemName  *string
 	Block     *block.BlockStatement
+	Position  common.Position
 }
 
 func (fas *ForkArrayStatement) Print(start string) {
@@ -36,5 +37,9 @@ func (fas *ForkArrayStatement) Print(start string) {
 }
 
 func (fas *ForkArrayStatement) Headline() string {
-	return common.Colorize("Fork Array Statement", common.COLOR_CYAN)
+	return common.Colorize(fas.Kind(), common.COLOR_CYAN)
+}
+
+func (fas *ForkArrayStatement) Kind() string {
+	return "Fork Array Statement"
 }
@@ -8,7 +8,8 @@ import (
 )
 
 type ForkBlockStatement struct {
-	Block *block.BlockStatement
+	Block    *block.BlockStatement
+	Position common.Position
 }
 
 func (fs ForkBlockStatement) Print(start string) {
@@ -17,5 +18,9 @@ func (fs ForkBlockStatement) Print(start string) {
 }
 
 func (fs ForkBlockStatement) Headline() string {
-	return common.Colorize("Fork Statement", common.COLOR_CYAN)
+	return common.Colorize(fs.Kind(), common.COLOR_CYAN)
+}
+
+func (fs ForkBlockStatement) Kind() string {
+	return "Fork Statement"
 }
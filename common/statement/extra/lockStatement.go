@@ -0,0 +1,35 @@
+package extra
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/statement/block"
+)
+
+// LockStatement runs its block holding a lock, so no other branch holding
+// the same lock runs at once. A nil Name is the lock of atomic blocks.
+type LockStatement struct {
+	Name     *string
+	Block    *block.BlockStatement
+	Position common.Position
+}
+
+func (ls LockStatement) Print(start string) {
+	if ls.Name != nil {
+		fmt.Printf("%s%s %s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Name:", common.COLOR_YELLOW), common.Colorize(*ls.Name, common.COLOR_WHITE))
+	}
+	fmt.Printf("%s%s\n", start+string(common.LAST_CONNECTOR), common.Colorize("Body:", common.COLOR_YELLOW))
+	ls.Block.Print(start + string(common.SIMPLE_INDENT))
+}
+
+func (ls LockStatement) Headline() string {
+	return common.Colorize(ls.Kind(), common.COLOR_CYAN)
+}
+
+func (ls LockStatement) Kind() string {
+	if ls.Name == nil {
+		return "Atomic Statement"
+	}
+	return "Lock Statement"
+}
@@ -8,7 +8,8 @@ import (
 )
 
 type PrintStatement struct {
-	Value expression.Expression
+	Value    expression.Expression
+	Position common.Position
 }
 
 func (ps PrintStatement) Print(start string) {
@@ -20,5 +21,9 @@ func (ps PrintStatement) Print(start string) {
 }
 
 func (ps PrintStatement) Headline() string {
-	return common.Colorize("Print Statement", common.COLOR_RED)
+	return common.Colorize(ps.Kind(), common.COLOR_RED)
+}
+
+func (ps PrintStatement) Kind() string {
+	return "Print Statement"
 }
@@ -0,0 +1,76 @@
+package extra
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/expression"
+	"github.com/Tinchocw/forky/common/statement/block"
+)
+
+// SelectStatement waits until one of its cases can send or receive, and runs
+// its body. With a default, it runs the default body instead of waiting.
+type SelectStatement struct {
+	Cases    []SelectCase
+	Default  *block.BlockStatement
+	Position common.Position
+}
+
+// SelectCase sends Value to Channel or, when Value is nil, receives from it
+// into Name, if there is one.
+type SelectCase struct {
+	Channel  expression.Expression
+	Value    expression.Expression
+	Name     *string
+	Body     *block.BlockStatement
+	Position common.Position
+}
+
+func (ss SelectStatement) Print(start string) {
+	for i, c := range ss.Cases {
+		last := i == len(ss.Cases)-1 && ss.Default == nil
+		c.Print(start, last)
+	}
+
+	if ss.Default != nil {
+		fmt.Printf("%s%s\n", start+string(common.LAST_CONNECTOR), common.Colorize("Default:", common.COLOR_YELLOW))
+		ss.Default.Print(start + string(common.SIMPLE_INDENT))
+	}
+}
+
+func (sc SelectCase) Print(start string, last bool) {
+	conn, indent := string(common.BRANCH_CONNECTOR), string(common.SIMPLE_CONNECTOR)
+	if last {
+		conn, indent = string(common.LAST_CONNECTOR), string(common.SIMPLE_INDENT)
+	}
+
+	if sc.Value != nil {
+		fmt.Printf("%s%s\n", start+conn, common.Colorize("Send Case:", common.COLOR_YELLOW))
+	} else {
+		fmt.Printf("%s%s\n", start+conn, common.Colorize("Receive Case:", common.COLOR_YELLOW))
+	}
+	start += indent
+
+	fmt.Printf("%s%s%s\n", start, string(common.BRANCH_CONNECTOR), common.Colorize("Channel:", common.COLOR_YELLOW))
+	sc.Channel.Print(start + string(common.SIMPLE_CONNECTOR) + string(common.LAST_CONNECTOR))
+
+	if sc.Value != nil {
+		fmt.Printf("%s%s%s\n", start, string(common.BRANCH_CONNECTOR), common.Colorize("Value:", common.COLOR_YELLOW))
+		sc.Value.Print(start + string(common.SIMPLE_CONNECTOR) + string(common.LAST_CONNECTOR))
+	}
+
+	if sc.Name != nil {
+		fmt.Printf("%s%s %s\n", start+string(common.BRANCH_CONNECTOR), common.Colorize("Name:", common.COLOR_YELLOW), common.Colorize(*sc.Name, common.COLOR_WHITE))
+	}
+
+	fmt.Printf("%s%s\n", start+string(common.LAST_CONNECTOR), common.Colorize("Body:", common.COLOR_YELLOW))
+	sc.Body.Print(start + string(common.SIMPLE_INDENT))
+}
+
+func (ss SelectStatement) Headline() string {
+	return common.Colorize(ss.Kind(), common.COLOR_CYAN)
+}
+
+func (ss SelectStatement) Kind() string {
+	return "Select Statement"
+}
@@ -6,12 +6,18 @@ import (
 	"github.com/Tinchocw/forky/common"
 )
 
-type BreakStatement struct{}
+type BreakStatement struct {
+	Position common.Position
+}
 
 func (bs BreakStatement) Print(start string) {
 	fmt.Printf("%s%s\n", start, common.Colorize("BreakStatement", common.COLOR_CYAN))
 }
 
 func (bs BreakStatement) Headline() string {
-	return common.Colorize("Break Statement", common.COLOR_CYAN)
+	return common.Colorize(bs.Kind(), common.COLOR_CYAN)
+}
+
+func (bs BreakStatement) Kind() string {
+	return "Break Statement"
 }
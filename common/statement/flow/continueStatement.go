@@ -0,0 +1,23 @@
+package flow
+
+import (
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+type ContinueStatement struct {
+	Position common.Position
+}
+
+func (cs ContinueStatement) Print(start string) {
+	fmt.Printf("%s%s\n", start, common.Colorize("ContinueStatement", common.COLOR_CYAN))
+}
+
+func (cs ContinueStatement) Headline() string {
+	return common.Colorize(cs.Kind(), common.COLOR_CYAN)
+}
+
+func (cs ContinueStatement) Kind() string {
+	return "Continue Statement"
+}
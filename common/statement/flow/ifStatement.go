@@ -13,6 +13,7 @@ type IfStatement struct {
 	Body      *block.BlockStatement
 	ElseIf    *ElseIfStatement
 	Else      *ElseStatement
+	Position  common.Position
 }
 
 type ElseIfStatement struct {
@@ -69,5 +70,9 @@ func (es ElseStatement) Print(start string) {
 }
 
 func (ifs IfStatement) Headline() string {
-	return common.Colorize("If Statement", common.COLOR_BLUE)
+	return common.Colorize(ifs.Kind(), common.COLOR_BLUE)
+}
+
+func (ifs IfStatement) Kind() string {
+	return "If Statement"
 }
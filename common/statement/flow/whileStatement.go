@@ -11,6 +11,7 @@ import (
 type WhileStatement struct {
 	Condition expression.Expression
 	Body      *block.BlockStatement
+	Position  common.Position
 }
 
 func (ws WhileStatement) Print(start string) {
@@ -22,5 +23,9 @@ func (ws WhileStatement) Print(start string) {
 }
 
 func (ws WhileStatement) Headline() string {
-	return common.Colorize("While Statement", common.COLOR_BLUE)
+	return common.Colorize(ws.Kind(), common.COLOR_BLUE)
+}
+
+func (ws WhileStatement) Kind() string {
+	return "While Statement"
 }
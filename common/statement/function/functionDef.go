@@ -11,6 +11,7 @@ type FunctionDef struct {
 	Name       *string
 	Parameters []string
 	Body       *block.BlockStatement
+	Position   common.Position
 }
 
 func (fd FunctionDef) Print(start string) {
@@ -36,5 +37,9 @@ func (fd FunctionDef) Print(start string) {
 }
 
 func (fd FunctionDef) Headline() string {
-	return common.Colorize("Function Definition", common.COLOR_CYAN)
+	return common.Colorize(fd.Kind(), common.COLOR_CYAN)
+}
+
+func (fd FunctionDef) Kind() string {
+	return "Function Definition"
 }
@@ -8,7 +8,8 @@ import (
 )
 
 type ReturnStatement struct {
-	Value expression.Expression
+	Value    expression.Expression
+	Position common.Position
 }
 
 func (r ReturnStatement) Print(start string) {
@@ -20,5 +21,9 @@ func (r ReturnStatement) Print(start string) {
 }
 
 func (r ReturnStatement) Headline() string {
-	return common.Colorize("Return Statement", common.COLOR_CYAN)
+	return common.Colorize(r.Kind(), common.COLOR_CYAN)
+}
+
+func (r ReturnStatement) Kind() string {
+	return "Return Statement"
 }
@@ -1,19 +1,9 @@
 package statement
 
-import (
-	"fmt"
+import "github.com/Tinchocw/forky/common"
 
-	"github.com/Tinchocw/forky/common"
-)
-
-type Statement interface {
-	Print(start string)
-	Headline() string
-}
+type Statement = common.Statement
 
 func PrintStatements(start string, statements []Statement) {
-	for i, stmt := range statements {
-		fmt.Printf("%s%4d: %s\n", start, i+1, stmt.Headline())
-		stmt.Print(common.AdvanceSuffix(start + string(common.COUNTER_INDENT)))
-	}
+	common.PrintStatements(start, statements)
 }
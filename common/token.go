@@ -8,6 +8,7 @@ import (
 type Token struct {
 	Typ   TokenType
 	Value string
+	Span  Span
 }
 
 func NewToken(typ TokenType) Token                        { return Token{Typ: typ, Value: ""} }
@@ -171,6 +172,12 @@ const (
 	// SPECIAL TOKENS
 	PRINT
 	FORK
+	LOCK
+	ATOMIC
+	SELECT
+	CASE
+	DEFAULT
+	REDUCE
 
 	// PRE MERGE
 	STARTED_LITERAL
@@ -215,6 +222,12 @@ var tokenTypeNames = [...]string{
 	VAR:               "VAR",
 	SET:               "SET",
 	FORK:              "FORK",
+	LOCK:              "LOCK",
+	ATOMIC:            "ATOMIC",
+	SELECT:            "SELECT",
+	CASE:              "CASE",
+	DEFAULT:           "DEFAULT",
+	REDUCE:            "REDUCE",
 	STARTED_LITERAL:   "STARTED_LITERAL",
 	ENDED_LITERAL:     "ENDED_LITERAL",
 	OR:                "OR",
@@ -241,6 +254,7 @@ const (
 	GREATER_SYMBOL           = '>'
 	START_QUOTE_SYMBOL       = '"'
 	END_QUOTE_SYMBOL         = '\''
+	ESCAPE_SYMBOL            = '\\'
 	OPEN_PARENTHESIS_SYMBOL  = '('
 	CLOSE_PARENTHESIS_SYMBOL = ')'
 	COMMA_SYMBOL             = ','
@@ -250,6 +264,14 @@ const (
 	CLOSE_BRACES_SYMBOL      = '}'
 	OPEN_BRACKET_SYMBOL      = '['
 	CLOSE_BRACKET_SYMBOL     = ']'
+	DECIMAL_POINT_SYMBOL     = '.'
+)
+
+// Comment delimiters
+const (
+	LINE_COMMENT_START  = "//"
+	BLOCK_COMMENT_START = "/*"
+	BLOCK_COMMENT_END   = "*/"
 )
 
 // Keywords
@@ -270,6 +292,12 @@ const (
 	AND_KEYWORD      = "and"
 	PRINT_KEYWORD    = "print"
 	FORK_KEYWORD     = "fork"
+	LOCK_KEYWORD     = "lock"
+	ATOMIC_KEYWORD   = "atomic"
+	SELECT_KEYWORD   = "select"
+	CASE_KEYWORD     = "case"
+	DEFAULT_KEYWORD  = "default"
+	REDUCE_KEYWORD   = "reduce"
 )
 
 var KEYWORDS = map[string]TokenType{
@@ -289,6 +317,12 @@ var KEYWORDS = map[string]TokenType{
 	AND_KEYWORD:      AND,
 	PRINT_KEYWORD:    PRINT,
 	FORK_KEYWORD:     FORK,
+	LOCK_KEYWORD:     LOCK,
+	ATOMIC_KEYWORD:   ATOMIC,
+	SELECT_KEYWORD:   SELECT,
+	CASE_KEYWORD:     CASE,
+	DEFAULT_KEYWORD:  DEFAULT,
+	REDUCE_KEYWORD:   REDUCE,
 }
 
 var KEYWORDS_VALUES = map[TokenType]string{
@@ -308,6 +342,12 @@ var KEYWORDS_VALUES = map[TokenType]string{
 	AND:      AND_KEYWORD,
 	PRINT:    PRINT_KEYWORD,
 	FORK:     FORK_KEYWORD,
+	LOCK:     LOCK_KEYWORD,
+	ATOMIC:   ATOMIC_KEYWORD,
+	SELECT:   SELECT_KEYWORD,
+	CASE:     CASE_KEYWORD,
+	DEFAULT:  DEFAULT_KEYWORD,
+	REDUCE:   REDUCE_KEYWORD,
 }
 
 func IsNumber(r rune) bool {
@@ -339,5 +379,5 @@ func PrintTokens(tokens []Token) {
 }
 
 func PrintToken(index int, token Token) {
-	fmt.Printf("%4d: %s\n", index, token.ColorString())
+	fmt.Printf("%4d: %-8s %s\n", index, token.Span.Start.String(), token.ColorString())
 }
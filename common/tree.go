@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -30,3 +31,20 @@ func AdvanceSuffix(start string) string {
 		return start
 	}
 }
+
+// Statement is a statement of the syntax tree. It is defined here, below the
+// expression and statement packages, so that expressions can hold blocks of
+// statements, as function literals do.
+type Statement interface {
+	Print(start string)
+	Headline() string
+	// Kind names the kind of statement, as Headline does but without colors.
+	Kind() string
+}
+
+func PrintStatements(start string, statements []Statement) {
+	for i, stmt := range statements {
+		fmt.Printf("%s%4d: %s\n", start, i+1, stmt.Headline())
+		stmt.Print(AdvanceSuffix(start + string(COUNTER_INDENT)))
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"strings"
 
+	"github.com/Tinchocw/forky/checker"
 	"github.com/Tinchocw/forky/common"
 	"github.com/Tinchocw/forky/common/statement"
 	"github.com/Tinchocw/forky/interpreter"
 	"github.com/Tinchocw/forky/parser"
+	"github.com/Tinchocw/forky/resolver"
 	"github.com/Tinchocw/forky/scanner"
 	"github.com/peterh/liner"
 )
@@ -18,7 +22,7 @@ const (
 	NormalMode InterpreterMode = iota
 	ScanningMode
 	ParsingMode
-	// ResolveMode
+	ResolvingMode
 )
 
 // Forky is the top-level runner that coordinates the scanning (and future phases).
@@ -27,14 +31,17 @@ type Forky struct {
 	debug       bool
 	mode        InterpreterMode
 	interpreter *interpreter.Interpreter
+	// interactive is set for the REPL, where a function may use names that
+	// only a later input declares.
+	interactive bool
 }
 
-func NewForky(workers int, debug bool, mode InterpreterMode) *Forky {
+func NewForky(workers int, debug bool, mode InterpreterMode, options ...interpreter.Option) *Forky {
 	if workers < 1 {
 		workers = 1
 	}
 
-	i := interpreter.NewInterpreter()
+	i := interpreter.NewInterpreter(options...)
 	return &Forky{workers: workers, debug: debug, mode: mode, interpreter: &i}
 }
 
@@ -71,7 +78,48 @@ func (forky *Forky) Run(r io.ReaderAt, size int64) (string, error) {
 		return "", nil
 	}
 
-	return forky.interpreter.Execute(program)
+	rs := resolver.CreateResolver(forky.debug)
+	bindings, err := rs.Resolve(program, interpreter.BuiltinNames(), forky.interpreter.GetGlobalVariables())
+	if err != nil && forky.interactive {
+		err = deferUndefined(err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	checker.PrintWarnings(checker.CreateChecker(forky.debug).Check(program))
+
+	if forky.mode == ResolvingMode {
+		resolver.PrintBindings(bindings)
+		return "", nil
+	}
+
+	result, err := forky.interpreter.Execute(program)
+	interpreter.PrintRaces(forky.interpreter.Races())
+	return result, err
+}
+
+// deferUndefined warns about the undefined names used in function bodies,
+// which a later input may still declare before the functions are called,
+// and returns the other resolve errors.
+func deferUndefined(err error) error {
+	var errs resolver.ResolveErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	var rest resolver.ResolveErrors
+	for _, e := range errs {
+		if e.Deferred {
+			fmt.Println(common.Colorize("WARNING: "+e.Error(), common.COLOR_YELLOW))
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	if len(rest) > 0 {
+		return rest
+	}
+	return nil
 }
 
 func (f *Forky) WordCompleter() liner.WordCompleter {
@@ -82,8 +130,10 @@ func (f *Forky) WordCompleter() liner.WordCompleter {
 
 	return func(line string, pos int) (string, []string, string) {
 		globalVars := f.interpreter.GetGlobalVariables()
-		options := make([]string, 0, len(keywords)+len(globalVars))
+		builtins := interpreter.BuiltinNames()
+		options := make([]string, 0, len(keywords)+len(builtins)+len(globalVars))
 		options = append(options, keywords...)
+		options = append(options, builtins...)
 		options = append(options, globalVars...)
 
 		// Find the current word being typed
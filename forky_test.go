@@ -0,0 +1,845 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tinchocw/forky/common/statement"
+	"github.com/Tinchocw/forky/interpreter"
+	interpreterErrors "github.com/Tinchocw/forky/interpreter/errors"
+	"github.com/Tinchocw/forky/parser"
+	"github.com/Tinchocw/forky/scanner"
+)
+
+// TestUsecaseExamples runs the use case examples, whose fork branches share
+// arrays and variables. Run it with -race (make test-race) to check them.
+func TestUsecaseExamples(t *testing.T) {
+	paths, err := filepath.Glob("examples/usecases/*.forky")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		for _, forkWorkers := range []int{0, 2} {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			forky := NewForky(DEFAULT_WORKERS, false, NormalMode, interpreter.WithForkWorkers(forkWorkers))
+			if _, err := forky.Run(f, st.Size()); err != nil {
+				t.Errorf("%s with %d fork workers: %v", path, forkWorkers, err)
+			}
+			f.Close()
+		}
+	}
+}
+
+// TestConcurrentArrayAccess makes fork branches read and write the same
+// array cells, which the race detector reports unless arrays guard them.
+func TestConcurrentArrayAccess(t *testing.T) {
+	source := `
+var cells[4] = 0;
+var grid[3][3] = 0;
+fork [0, 1, 2, 3, 4, 5, 6, 7] i, e {
+    set cells[i / 2] = cells[i / 2] + e;
+    set grid[i / 3][i - (i / 3) * 3] = cells[0];
+    print(cells);
+}
+`
+	forky := NewForky(DEFAULT_WORKERS, false, NormalMode)
+	if _, err := forky.Run(strings.NewReader(source), int64(len(source))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parse(t *testing.T, source string) statement.Program {
+	t.Helper()
+	sc := scanner.CreateForkyScanner(DEFAULT_WORKERS, false)
+	tokens, err := sc.Scan(strings.NewReader(source), int64(len(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := parser.CreateForkyParser(DEFAULT_WORKERS, false)
+	program, err := ps.Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+// execute runs source on a fresh interpreter and returns its result.
+func execute(t *testing.T, source string) string {
+	t.Helper()
+	i := interpreter.NewInterpreter()
+	result, err := i.Execute(parse(t, source))
+	if err != nil {
+		t.Fatalf("%s: %v", source, err)
+	}
+	return result
+}
+
+func detectRaces(t *testing.T, source string) []interpreter.Race {
+	t.Helper()
+	i := interpreter.NewInterpreter(interpreter.WithRaceDetection())
+	if _, err := i.Execute(parse(t, source)); err != nil {
+		t.Fatal(err)
+	}
+	return i.Races()
+}
+
+func TestRaceDetection(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		races  []string
+	}{
+		{
+			name:   "shared variable",
+			source: `var total = 0; fork [1, 2, 3] e { set total = total + e; }`,
+			races:  []string{"total"},
+		},
+		{
+			name:   "shared array cell",
+			source: `var cells[2] = 0; fork { set cells[1] = 1; print(cells[1]); }`,
+			races:  []string{"cells[1]"},
+		},
+		{
+			name:   "disjoint array cells",
+			source: `var cells[3] = 0; fork [0, 1, 2] i, e { set cells[i] = e; }`,
+		},
+		{
+			name:   "branch locals",
+			source: `fork [1, 2, 3] e { var x = e; set x = x * 2; }`,
+		},
+		{
+			name:   "updates under a lock",
+			source: `var total = 0; fork [1, 2, 3] e { atomic { set total = total + e; } }`,
+		},
+		{
+			name:   "update missing the lock",
+			source: `var total = 0; fork { lock t { set total = 1; } set total = 2; }`,
+			races:  []string{"total"},
+		},
+		{
+			name:   "sequential forks",
+			source: `var total = 0; fork { set total = 1; } fork { set total = 2; }`,
+		},
+		{
+			name:   "handed over through a channel",
+			source: `var x = 0; var c = channel(0); fork { { set x = 1; send(c, 1); } { receive(c); print(x); } }`,
+		},
+		{
+			name:   "handed over by closing a channel",
+			source: `var x = 0; var c = channel(1); fork { { set x = 1; close(c); } { receive(c); print(x); } }`,
+		},
+		{
+			name:   "handed over from a nested fork",
+			source: `var x = 0; var c = channel(1); fork { { fork { set x = 1; } send(c, 1); } { receive(c); print(x); } }`,
+		},
+		{
+			name:   "handed over through a select",
+			source: `var x = 0; var c = channel(0); fork { { set x = 1; select { case send(c, 1) {} } } { select { case receive(c) v {} } print(x); } }`,
+		},
+		{
+			name:   "written after the send",
+			source: `var x = 0; var c = channel(1); fork { { send(c, 1); set x = 1; } { receive(c); print(x); } }`,
+			races:  []string{"x"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			races := detectRaces(t, test.source)
+			names := make([]string, len(races))
+			for i, race := range races {
+				names[i] = race.Name
+			}
+			if strings.Join(names, ",") != strings.Join(test.races, ",") {
+				t.Errorf("got races on %v, want %v", names, test.races)
+			}
+		})
+	}
+}
+
+// TestLockRelease leaves lock blocks in every way but their end, and checks
+// that a later lock block still acquires the lock.
+func TestLockRelease(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		fails  bool
+	}{
+		{
+			name:   "return inside a function",
+			source: `func f() { lock m { return 1; } } f();`,
+		},
+		{
+			name:   "break inside a loop",
+			source: `while (true) { lock m { break; } }`,
+		},
+		{
+			name: "runtime error in a fork branch",
+			// The second branch waits for the lock while the first one fails.
+			source: `var c = channel(0);
+fork {
+    { lock m { send(c, 1); var x = 1 / 0; } }
+    { receive(c); lock m { } }
+}`,
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := interpreter.NewInterpreter(interpreter.WithTimeout(5 * time.Second))
+			_, err := i.Execute(parse(t, test.source))
+			if test.fails {
+				var deadlock interpreterErrors.DeadlockErr
+				if err == nil || errors.As(err, &deadlock) {
+					t.Fatalf("got error %v, want the branch failure", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := i.Execute(parse(t, `var n = 0; lock m { set n = 1; } n;`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != "1" {
+				t.Errorf("got %s, want 1", result)
+			}
+		})
+	}
+}
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		result   string
+		deadlock bool
+	}{
+		{
+			name: "pipeline",
+			source: `
+var jobs = channel(2);
+var results = channel(0);
+var total = 0;
+fork {
+    {
+        var i = 1;
+        while (i <= 100) { send(jobs, i); set i = i + 1; }
+        close(jobs);
+    }
+    {
+        fork [0, 1, 2, 3] w {
+            var job = receive(jobs);
+            while (job != none) { send(results, job); set job = receive(jobs); }
+        }
+        close(results);
+    }
+    {
+        var result = receive(results);
+        while (result != none) { set total = total + result; set result = receive(results); }
+    }
+}
+total;
+`,
+			result: "5050",
+		},
+		{
+			name:   "select default",
+			source: `var c = channel(0); var got = 0; select { case receive(c) v { set got = v; } default { set got = -1; } } got;`,
+			result: "-1",
+		},
+		{
+			name:   "closed channel",
+			source: `var c = channel(1); send(c, 1); close(c); var a = receive(c); if (receive(c) == none) { set a = a + 10; } a;`,
+			result: "11",
+		},
+		{
+			name:     "receive with no sender",
+			source:   `var c = channel(0); receive(c);`,
+			deadlock: true,
+		},
+		{
+			name:     "branches waiting on each other",
+			source:   `var a = channel(0); var b = channel(0); fork { { receive(a); send(b, 1); } { receive(b); send(a, 1); } }`,
+			deadlock: true,
+		},
+		{
+			name:   "select receiving from a waiting sender",
+			source: `var a = channel(0); var b = channel(0); var got = 0; fork { { send(b, 2); } { select { case receive(a) x { set got = x; } case receive(b) y { set got = y; } } } } got;`,
+			result: "2",
+		},
+		{
+			name:     "select taking one of two unbuffered sends",
+			source:   `var a = channel(0); var b = channel(0); fork { { send(a, 1); } { send(b, 2); } { select { case receive(a) x { } case receive(b) y { } } } }`,
+			deadlock: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, forkWorkers := range []int{0, 2} {
+				i := interpreter.NewInterpreter(interpreter.WithForkWorkers(forkWorkers))
+				result, err := i.Execute(parse(t, test.source))
+
+				var deadlock interpreterErrors.DeadlockErr
+				if test.deadlock != errors.As(err, &deadlock) {
+					t.Fatalf("fork workers %d: got error %v, want a deadlock: %v", forkWorkers, err, test.deadlock)
+				}
+				if !test.deadlock && err != nil {
+					t.Fatalf("fork workers %d: %v", forkWorkers, err)
+				}
+				if result != test.result {
+					t.Errorf("fork workers %d: got %q, want %q", forkWorkers, result, test.result)
+				}
+			}
+		})
+	}
+}
+
+func TestUnbufferedSelect(t *testing.T) {
+	// Whichever way the branches interleave, a select takes a single value,
+	// so the other unbuffered send never finds a receiver.
+	source := `var a = channel(0); var b = channel(0); fork { { send(a, 1); } { send(b, 2); } { select { case receive(a) x { } case receive(b) y { } } } }`
+
+	for seed := range int64(20) {
+		i := interpreter.NewInterpreter(interpreter.WithDeterministicScheduling(seed))
+		_, err := i.Execute(parse(t, source))
+
+		var deadlock interpreterErrors.DeadlockErr
+		if !errors.As(err, &deadlock) {
+			t.Fatalf("seed %d: got error %v, want a deadlock", seed, err)
+		}
+		senders := 0
+		for _, branch := range deadlock.Branches {
+			if branch.Reason == "sending to a channel" {
+				senders++
+			}
+		}
+		if senders != 1 {
+			t.Errorf("seed %d: got blocked branches %v, want a single sender", seed, deadlock.Branches)
+		}
+	}
+}
+
+func TestDeadlockReport(t *testing.T) {
+	source := `var handshake = channel(0);
+fork {
+    {
+        lock a {
+            send(handshake, 1);
+            lock b { }
+        }
+    }
+    {
+        lock b {
+            receive(handshake);
+            lock a { }
+        }
+    }
+}
+`
+	branches := []string{
+		"branch 0 of the fork at 2:1, at 6:13 (Lock Statement): waiting for lock 'b'",
+		"branch 1 of the fork at 2:1, at 12:13 (Lock Statement): waiting for lock 'a'",
+	}
+	tests := []struct {
+		forkWorkers int
+		want        []string
+	}{
+		{0, append([]string{"main program, at 2:1 (Fork Statement): waiting for the branches of the fork at 2:1"}, branches...)},
+		// The main program runs branch 0 itself, so it is not waiting on the fork.
+		{1, branches},
+	}
+
+	for _, test := range tests {
+		i := interpreter.NewInterpreter(interpreter.WithForkWorkers(test.forkWorkers))
+		_, err := i.Execute(parse(t, source))
+
+		var deadlock interpreterErrors.DeadlockErr
+		if !errors.As(err, &deadlock) {
+			t.Fatalf("with %d fork workers got error %v, want a deadlock", test.forkWorkers, err)
+		}
+		if len(deadlock.Branches) != len(test.want) {
+			t.Fatalf("with %d fork workers got blocked branches %v, want %v", test.forkWorkers, deadlock.Branches, test.want)
+		}
+		for index, branch := range deadlock.Branches {
+			if branch.String() != test.want[index] {
+				t.Errorf("with %d fork workers blocked branch %d: got %q, want %q", test.forkWorkers, index, branch.String(), test.want[index])
+			}
+		}
+
+		// The interpreter is still usable afterwards, as in the REPL.
+		if result, err := i.Execute(parse(t, "lock a { } lock b { } 1;")); err != nil || result != "1" {
+			t.Errorf("with %d fork workers after the deadlock got %q, %v", test.forkWorkers, result, err)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		// Mixing ints and floats promotes the int.
+		{`1 + 2.5;`, "3.5"},
+		{`7 / 2.0;`, "3.5"},
+		{`7 / 2;`, "3"},
+		{`1 < 1.5;`, "true"},
+		{`2.0 == 2;`, "true"},
+		// Printed forms.
+		{`2.0;`, "2.0"},
+		{`1e21;`, "1e+21"},
+		{`-0.0;`, "-0.0"},
+		{`0.1 + 0.2;`, "0.30000000000000004"},
+	}
+	for _, test := range tests {
+		if result := execute(t, test.source); result != test.want {
+			t.Errorf("%s: got %s, want %s", test.source, result, test.want)
+		}
+	}
+
+	for _, source := range []string{`1e400;`, `99999999999999999999;`} {
+		i := interpreter.NewInterpreter()
+		_, err := i.Execute(parse(t, source))
+		if err == nil || !strings.Contains(err.Error(), "number out of range") {
+			t.Errorf("%s: got error %v, want it out of range", source, err)
+		}
+	}
+}
+
+func TestContinue(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		// Odd numbers are skipped, and the condition is checked again.
+		{`var i = 0; var sum = 0;
+while (i < 10) { set i = i + 1; if (i / 2 * 2 != i) { continue; } set sum = sum + i; }
+sum;`, "30"},
+		// continue only skips the rest of the innermost loop.
+		{`var i = 0; var count = 0;
+while (i < 3) {
+    set i = i + 1;
+    var j = 0;
+    while (j < 4) { set j = j + 1; if (j == 2) { continue; } set count = count + 1; }
+    if (i == 2) { continue; }
+    set count = count + 10;
+}
+count;`, "29"},
+	}
+	for _, test := range tests {
+		if result := execute(t, test.source); result != test.want {
+			t.Errorf("%s: got %s, want %s", test.source, result, test.want)
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		// Functions outlive the scope of their variables.
+		{`func make_adder(n) { func adder(x) { return x + n; } return adder; }
+var add_five = make_adder(5); var add_ten = make_adder(10);
+add_five(1) + add_ten(1);`, "17"},
+		// The variables are the ones where the function was defined, not
+		// where it is called.
+		{`var x = "global';
+func show() { return x; }
+func call() { var x = "local'; return show(); }
+call();`, "global"},
+		// Closures share their variables, and see them change.
+		{`func counter() { var n = 0; func next() { set n = n + 1; return n; } return next; }
+var next = counter(); next(); next();
+next();`, "3"},
+	}
+	for _, test := range tests {
+		if result := execute(t, test.source); result != test.want {
+			t.Errorf("%s: got %s, want %s", test.source, result, test.want)
+		}
+	}
+}
+
+func TestFunctionLiterals(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`var square = func(x) { return x * x; }; square(7);`, "49"},
+		{`func apply(f, x) { return f(x); } apply(func(x) { return x + 1; }, 41);`, "42"},
+		// Immediately invoked, with and without arguments.
+		{`var n = func(a, b) { return a * b; }(6, 7); n;`, "42"},
+		{`var base = 40; var n = func() { return base + 2; }(); n;`, "42"},
+		{`func() { return 1; }() + 1;`, "2"},
+	}
+	for _, test := range tests {
+		if result := execute(t, test.source); result != test.want {
+			t.Errorf("%s: got %s, want %s", test.source, result, test.want)
+		}
+	}
+}
+
+// TestREPL runs inputs one after the other on the same Forky, as the REPL
+// does. Functions may use names that a later input declares.
+func TestREPL(t *testing.T) {
+	forky := NewForky(DEFAULT_WORKERS, false, NormalMode)
+	forky.interactive = true
+
+	inputs := []struct {
+		source string
+		want   string
+		fails  bool
+	}{
+		{source: `func h() { return y; }`},
+		{source: `h();`, fails: true},
+		{source: `var y = 3;`},
+		{source: `h();`, want: "3"},
+		{source: `var y = 4;`, fails: true},
+		{source: `print(z);`, fails: true},
+		{source: `set y = 5; h();`, want: "5"},
+	}
+	for _, input := range inputs {
+		result, err := forky.Run(strings.NewReader(input.source), int64(len(input.source)))
+		if input.fails {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", input.source, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", input.source, err)
+		} else if result != input.want {
+			t.Errorf("%s: got %q, want %q", input.source, result, input.want)
+		}
+	}
+}
+
+func TestForkFailures(t *testing.T) {
+	// The failing branches meet and fail within the same statement, so both
+	// fail before either cancels the other. The looping one is cancelled,
+	// or never starts with a single worker.
+	source := `var c = channel(0);
+fork {
+    { var a = send(c, 1) / 2; }
+    { var b = receive(c) / 0; }
+    { while (true) {} }
+}`
+	for _, forkWorkers := range []int{0, 1} {
+		i := interpreter.NewInterpreter(interpreter.WithForkWorkers(forkWorkers))
+		_, err := i.Execute(parse(t, source))
+
+		var fork interpreterErrors.ForkErr
+		if !errors.As(err, &fork) {
+			t.Fatalf("fork workers %d: got %v, want a ForkErr", forkWorkers, err)
+		}
+		if len(fork.Branches) != 2 || fork.Branches[0].Index != 0 || fork.Branches[1].Index != 1 {
+			t.Fatalf("fork workers %d: got %v, want branches 0 and 1 to fail", forkWorkers, err)
+		}
+		if !strings.HasPrefix(err.Error(), "fork failed in branches [0, 1]:") {
+			t.Errorf("fork workers %d: got message %q", forkWorkers, err.Error())
+		}
+
+		runtimeErrs := interpreterErrors.RuntimeErrors(err)
+		if len(runtimeErrs) != 2 || runtimeErrs[0].Kind != interpreterErrors.TYPE_ERROR || runtimeErrs[1].Kind != interpreterErrors.ARITHMETIC_ERROR {
+			t.Errorf("fork workers %d: got %v, want a TypeError and an ArithmeticError", forkWorkers, runtimeErrs)
+		}
+	}
+}
+
+func TestForkExpression(t *testing.T) {
+	tests := []struct {
+		source string
+		result string
+	}{
+		{`var nums = [1, 2, 3, 4]; var squares = fork nums e { return e * e; }; squares;`, "[1, 4, 9, 16]"},
+		{`var sums = fork [5, 6, 7] i, e { if (i == 1) { return; } return i + e; }; sums;`, "[5, none, 9]"},
+		{`var table = fork [1, 2] a { return fork [10, 20] b { return a * b; }; }; table;`, "[[10, 20], [20, 40]]"},
+		{`var empty = fork [] e { return e; }; empty;`, "[]"},
+	}
+
+	for _, test := range tests {
+		for _, forkWorkers := range []int{0, 1} {
+			i := interpreter.NewInterpreter(interpreter.WithForkWorkers(forkWorkers))
+			result, err := i.Execute(parse(t, test.source))
+			if err != nil {
+				t.Fatalf("%s: %v", test.source, err)
+			}
+			if result != test.result {
+				t.Errorf("%s with fork workers %d: got %s, want %s", test.source, forkWorkers, result, test.result)
+			}
+		}
+	}
+}
+
+func TestForkReduce(t *testing.T) {
+	// digits lists the digits from 0 to 9 as strings, 50 times over.
+	digits := strings.TrimSuffix(strings.Repeat(`"0', "1', "2', "3', "4', "5', "6', "7', "8', "9', `, 50), ", ")
+
+	tests := []struct {
+		source string
+		result string
+	}{
+		{`func add(a, b) { return a + b; } var total = fork reduce([1, 2, 3, 4, 5, 6, 7], 0, add); total;`, "28"},
+		{`var joined = fork reduce(["a', "b', "c', "d', "e'], "', func(a, b) { return a + b; }); joined;`, "abcde"},
+		{`var empty = fork reduce([], 42, func(a, b) { return a + b; }); empty;`, "42"},
+		{`var rows = fork [[1, 2], [3, 4]] row { return fork reduce(row, 1, func(a, b) { return a * b; }); }; rows;`, "[2, 12]"},
+		// Enough elements to fork, and combine in sequence, at several levels.
+		{`var digits = [` + digits + `]; var joined = fork reduce(digits, "', func(a, b) { return a + b; }); joined;`, strings.Repeat("0123456789", 50)},
+	}
+
+	for _, test := range tests {
+		for _, forkWorkers := range []int{0, 1} {
+			i := interpreter.NewInterpreter(interpreter.WithForkWorkers(forkWorkers))
+			result, err := i.Execute(parse(t, test.source))
+			if err != nil {
+				t.Fatalf("%s: %v", test.source, err)
+			}
+			if result != test.result {
+				t.Errorf("%s with fork workers %d: got %s, want %s", test.source, forkWorkers, result, test.result)
+			}
+		}
+	}
+
+	i := interpreter.NewInterpreter()
+	if _, err := i.Execute(parse(t, `fork reduce([1, 2], 0, 3);`)); err == nil || !strings.Contains(err.Error(), "expected a combining function") {
+		t.Errorf("got %v, want an error about the combining function", err)
+	}
+}
+
+func TestDeterministicScheduling(t *testing.T) {
+	source := `
+var log = "';
+fork {
+    { var i = 0; while (i < 4) { atomic { set log = log + "a'; } set i = i + 1; } }
+    { var i = 0; while (i < 4) { atomic { set log = log + "b'; } set i = i + 1; } }
+    fork [1, 2] e { atomic { set log = log + e; } }
+}
+log;`
+
+	orders := map[string]bool{}
+	for seed := range int64(10) {
+		var results []string
+		for range 2 {
+			i := interpreter.NewInterpreter(interpreter.WithDeterministicScheduling(seed))
+			result, err := i.Execute(parse(t, source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			results = append(results, result)
+		}
+		if results[0] != results[1] {
+			t.Errorf("seed %d: got %s, then %s", seed, results[0], results[1])
+		}
+		orders[results[0]] = true
+	}
+
+	if len(orders) < 2 {
+		t.Errorf("every seed gave the same order: %v", orders)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	source := `func divide(a, b) {
+    return a / b;
+}
+
+func worker(n) {
+    return divide(10, n - 2);
+}
+
+var results = fork [1, 2, 3] n {
+    return worker(n);
+};`
+
+	i := interpreter.NewInterpreter()
+	_, err := i.Execute(parse(t, source))
+	runtimeErrs := interpreterErrors.RuntimeErrors(err)
+	if len(runtimeErrs) != 1 {
+		t.Fatalf("got %v, want a single runtime error", err)
+	}
+
+	runtimeErr := runtimeErrs[0]
+	if runtimeErr.Kind != interpreterErrors.ARITHMETIC_ERROR || runtimeErr.Error() != "2:14: division by zero" {
+		t.Errorf("got %s %q, want an ArithmeticError at 2:14", runtimeErr.Kind, runtimeErr.Error())
+	}
+
+	want := []string{
+		"divide, called at 6:12",
+		"worker, called at 10:12",
+		"branch 1 of the fork at 9:15",
+	}
+	if len(runtimeErr.Frames) != len(want) {
+		t.Fatalf("got frames %v, want %v", runtimeErr.Frames, want)
+	}
+	for index, frame := range runtimeErr.Frames {
+		if frame.String() != want[index] {
+			t.Errorf("frame %d: got %q, want %q", index, frame.String(), want[index])
+		}
+	}
+
+	if _, err := i.Execute(parse(t, "var cells = [1]; cells[1];")); err == nil {
+		t.Error("got no error for an index out of bounds")
+	} else if runtimeErrs := interpreterErrors.RuntimeErrors(err); len(runtimeErrs) != 1 || runtimeErrs[0].Kind != interpreterErrors.INDEX_ERROR || runtimeErrs[0].Span.Start.Column != 18 {
+		t.Errorf("got %v, want an IndexError at column 18", err)
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	i := interpreter.NewInterpreter(interpreter.WithMaxCallDepth(50))
+
+	// Fifty nested calls fit, in the main program as in a branch.
+	source := `func count(n) { if (n == 1) { return 1; } return 1 + count(n - 1); }
+var counts = fork [1, 2] e { return count(50); };
+counts;`
+	if result, err := i.Execute(parse(t, source)); err != nil || result != "[50, 50]" {
+		t.Fatalf("got %q, %v, want [50, 50]", result, err)
+	}
+
+	// Branches go on counting from the calls that forked them: the call of
+	// nested and fifty of count are one too many.
+	_, err := i.Execute(parse(t, `func nested() { var c = fork [1] e { return count(50); }; return c; } nested();`))
+	runtimeErrs := interpreterErrors.RuntimeErrors(err)
+	if len(runtimeErrs) != 1 || runtimeErrs[0].Kind != interpreterErrors.RECURSION_ERROR {
+		t.Fatalf("got %v, want a RecursionError", err)
+	}
+	if frames := runtimeErrs[0].Frames; len(frames) != 52 || frames[len(frames)-1].Function != "nested" {
+		t.Errorf("got %d frames, want 52 ending with the call of nested", len(frames))
+	}
+
+	// The error is caught: the interpreter goes on.
+	if result, err := i.Execute(parse(t, `count(3);`)); err != nil || result != "3" {
+		t.Errorf("after the recursion error got %q, %v", result, err)
+	}
+}
+
+func TestExecutionBudgets(t *testing.T) {
+	// The looping branch never takes a statement, and the others block.
+	source := `var c = channel(0);
+fork [1, 2, 3] e { if (e == 1) { while (true) {} } var x = receive(c); }`
+
+	i := interpreter.NewInterpreter(interpreter.WithTimeout(50 * time.Millisecond))
+	_, err := i.Execute(parse(t, source))
+	var timeout interpreterErrors.TimeoutErr
+	if !errors.As(err, &timeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("with a timeout got %v, want a TimeoutErr", err)
+	}
+
+	i = interpreter.NewInterpreter(interpreter.WithMaxSteps(1000), interpreter.WithDeterministicScheduling(1))
+	_, err = i.Execute(parse(t, source))
+	var steps interpreterErrors.StepLimitErr
+	if !errors.As(err, &steps) || steps.Steps != 1000 {
+		t.Errorf("with a step limit got %v, want a StepLimitErr of 1000 steps", err)
+	}
+	// Every execution gets the whole budget.
+	if result, err := i.Execute(parse(t, `var n = 0; while (n < 100) { set n = n + 1; } n;`)); err != nil || result != "100" {
+		t.Errorf("after running out of steps got %q, %v", result, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	i = interpreter.NewInterpreter()
+	_, err = i.ExecuteContext(ctx, parse(t, source))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("with a cancelled context got %v, want context.Canceled", err)
+	}
+}
+
+func TestArrayAllocationLimits(t *testing.T) {
+	i := interpreter.NewInterpreter(interpreter.WithMaxArrayCells(1000), interpreter.WithMaxAllocatedCells(5000))
+
+	tests := []struct {
+		source string
+		kind   interpreterErrors.ErrorKind
+	}{
+		{`var big[100000000][100000000];`, interpreterErrors.MEMORY_ERROR},
+		{`var rows[1000000000][0];`, interpreterErrors.MEMORY_ERROR},
+		{`var n = 0 - 1; var negative[n];`, interpreterErrors.VALUE_ERROR},
+		{`var k = 0; while (k < 10) { var a[900]; set k = k + 1; }`, interpreterErrors.MEMORY_ERROR},
+	}
+	for _, test := range tests {
+		_, err := i.Execute(parse(t, test.source))
+		runtimeErrs := interpreterErrors.RuntimeErrors(err)
+		if len(runtimeErrs) != 1 || runtimeErrs[0].Kind != test.kind {
+			t.Errorf("%s: got %v, want a %s", test.source, err, test.kind)
+		}
+	}
+
+	// Every execution starts over, and arrays within the limits work.
+	if result, err := i.Execute(parse(t, `var m[30][30] = 0; m[29][29];`)); err != nil || result != "0" {
+		t.Errorf("got %q, %v", result, err)
+	}
+
+	// A fork expression takes the cells of its results before any branch runs.
+	i = interpreter.NewInterpreter(interpreter.WithMaxAllocatedCells(1000))
+	_, err := i.Execute(parse(t, `var cells[900] = 0; var ran = false; var results = fork cells e { set ran = true; };`))
+	if runtimeErrs := interpreterErrors.RuntimeErrors(err); len(runtimeErrs) != 1 || runtimeErrs[0].Kind != interpreterErrors.MEMORY_ERROR {
+		t.Errorf("fork expression: got %v, want a %s", err, interpreterErrors.MEMORY_ERROR)
+	}
+	if result, err := i.Execute(parse(t, `ran;`)); err != nil || result != "false" {
+		t.Errorf("fork expression: got branches running %q, %v", result, err)
+	}
+}
+
+func TestValueComparison(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`[1, [2, 3]] == [1.0, [2, 3]];`, "true"},
+		{`[1, [2, 3]] == [1, [2, 4]];`, "false"},
+		{`[1, 2] == [1, 2, 3];`, "false"},
+		{`func f() { return 1; } var g = f; f == g;`, "true"},
+		{`func() { return 1; } == func() { return 1; };`, "false"},
+		{`none == none;`, "true"},
+		{`1 == "1';`, "false"},
+		{`[1] != none;`, "true"},
+		// Arrays that hold themselves are told apart by nothing.
+		{`var c[1]; set c[0] = c; var d[1]; set d[0] = d; c == d;`, "true"},
+		{`[1, 2] < [1, 3];`, "true"},
+		{`[1, 2] < [1, 2, 0];`, "true"},
+		{`["b', "a'] >= ["b'];`, "true"},
+		{`[2] <= [1.5, 3];`, "false"},
+		// Elements with no order still compare when they are equal.
+		{`[true] <= [true];`, "true"},
+		{`[none, 1] < [none, 2];`, "true"},
+		{`[false] > [false];`, "false"},
+		// NaN is equal to nothing and ordered with nothing, inside arrays too.
+		{`var a = [nan]; a == a;`, "false"},
+		{`var a = [nan]; a != a;`, "true"},
+		{`[1, nan] < [1, 2];`, "false"},
+		{`[1, nan] >= [1, 2];`, "false"},
+		{`[1, nan] <= [1, nan];`, "false"},
+		{`[0, nan] < [1, nan];`, "true"},
+	}
+	// nan is the NaN left by taking infinity from itself.
+	nan := `var inf = 1e308 * 10.0; var nan = inf - inf; `
+	for _, test := range tests {
+		i := interpreter.NewInterpreter()
+		result, err := i.Execute(parse(t, nan+test.source))
+		if err != nil || result != test.want {
+			t.Errorf("%s: got %q, %v, want %s", test.source, result, err, test.want)
+		}
+	}
+
+	i := interpreter.NewInterpreter()
+	_, err := i.Execute(parse(t, `[1, true] < [1, false];`))
+	if runtimeErrs := interpreterErrors.RuntimeErrors(err); len(runtimeErrs) != 1 || runtimeErrs[0].Message != "operator '<' not supported for type BOOL" {
+		t.Errorf("ordering booleans got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/statement"
+	"github.com/Tinchocw/forky/common/statement/assignment"
+	"github.com/Tinchocw/forky/common/statement/declaration"
+	"github.com/Tinchocw/forky/common/statement/extra"
+	"github.com/Tinchocw/forky/common/statement/flow"
+	"github.com/Tinchocw/forky/common/statement/function"
+)
+
+// branch is a line of execution: the main program, which has no parent, or
+// a branch of a fork. It knows the statement it is running, so a deadlock
+// can tell where every branch got stuck.
+type branch struct {
+	parent  *branch
+	fork    common.Position
+	index   int
+	current atomic.Pointer[statement.Statement]
+	// depth counts the function calls in progress in the branch, starting
+	// from those of the code that forked it. Only the branch changes it.
+	depth int
+}
+
+type branchKey struct{}
+
+func branchOf(ctx context.Context) *branch {
+	b, _ := ctx.Value(branchKey{}).(*branch)
+	return b
+}
+
+func withNewBranch(ctx context.Context, b *branch) context.Context {
+	return context.WithValue(ctx, branchKey{}, b)
+}
+
+func (b *branch) String() string {
+	if b == nil || b.parent == nil {
+		return "main program"
+	}
+	description := fmt.Sprintf("branch %d of the fork at %s", b.index, b.fork)
+	if b.parent.parent != nil {
+		description += ", in " + b.parent.String()
+	}
+	return description
+}
+
+// before orders branches by their forks and indexes, outermost first, and
+// the main program before all of them.
+func (b *branch) before(other *branch) bool {
+	path, otherPath := b.path(), other.path()
+	for i := range min(len(path), len(otherPath)) {
+		if path[i].fork.Offset != otherPath[i].fork.Offset {
+			return path[i].fork.Offset < otherPath[i].fork.Offset
+		}
+		if path[i].index != otherPath[i].index {
+			return path[i].index < otherPath[i].index
+		}
+	}
+	return len(path) < len(otherPath)
+}
+
+func (b *branch) path() []*branch {
+	var path []*branch
+	for ; b != nil && b.parent != nil; b = b.parent {
+		path = append([]*branch{b}, path...)
+	}
+	return path
+}
+
+// statement describes the statement the branch is running.
+func (b *branch) statement() string {
+	if b == nil {
+		return ""
+	}
+	current := b.current.Load()
+	if current == nil {
+		return ""
+	}
+
+	kind := (*current).Kind()
+	if position, ok := statementPosition(*current); ok {
+		return fmt.Sprintf("%s (%s)", position, kind)
+	}
+	return kind
+}
+
+func statementPosition(stmt statement.Statement) (common.Position, bool) {
+	switch s := stmt.(type) {
+	case *declaration.VarDeclaration:
+		return s.Position, true
+	case *declaration.ArrayDeclaration:
+		return s.Position, true
+	case *assignment.VarAssignment:
+		return s.Position, true
+	case *assignment.ArrayAssignment:
+		return s.Position, true
+	case *extra.PrintStatement:
+		return s.Position, true
+	case *extra.ForkBlockStatement:
+		return s.Position, true
+	case *extra.ForkArrayStatement:
+		return s.Position, true
+	case *extra.LockStatement:
+		return s.Position, true
+	case *extra.SelectStatement:
+		return s.Position, true
+	case *flow.IfStatement:
+		return s.Position, true
+	case *flow.WhileStatement:
+		return s.Position, true
+	case *flow.BreakStatement:
+		return s.Position, true
+	case *flow.ContinueStatement:
+		return s.Position, true
+	case *function.FunctionDef:
+		return s.Position, true
+	case *function.ReturnStatement:
+		return s.Position, true
+	case *statement.ExpressionStatement:
+		return s.Position, true
+	default:
+		return common.Position{}, false
+	}
+}
@@ -0,0 +1,42 @@
+package interpreter
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// budget bounds the steps an execution takes, whichever branches take them.
+// Once they run out, it cancels the execution. A nil budget has no bound.
+type budget struct {
+	limit  int64
+	steps  atomic.Int64
+	cancel context.CancelCauseFunc
+}
+
+func newBudget(limit int64) *budget {
+	if limit <= 0 {
+		return nil
+	}
+	return &budget{limit: limit}
+}
+
+// begin starts counting the steps of an execution, which cancel stops.
+func (b *budget) begin(cancel context.CancelCauseFunc) {
+	if b == nil {
+		return
+	}
+	b.steps.Store(0)
+	b.cancel = cancel
+}
+
+// take accounts for a step. It reports whether that step is the one the
+// budget ran out at, and the execution was cancelled.
+func (b *budget) take() bool {
+	if b == nil || b.steps.Add(1) != b.limit+1 {
+		return false
+	}
+	b.cancel(errors.NewStepLimitErr(b.limit))
+	return true
+}
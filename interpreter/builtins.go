@@ -0,0 +1,69 @@
+package interpreter
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// builtins are the functions every program can call. They live in a scope
+// of their own, around the globals, so programs may still use their names.
+func builtins(m *monitor) map[string]Function {
+	return map[string]Function{
+		"channel": newNativeFunction([]string{"capacity"}, func(ctx context.Context, args []Value) (Value, error) {
+			if args[0].Type() != VAL_INT || args[0].(*IntValue).Value < 0 {
+				return nil, errors.NewRuntimeError(errors.VALUE_ERROR, "channel capacity must be a non-negative integer, got %s", args[0].Content())
+			}
+			return NewChannelValue(args[0].(*IntValue).Value), nil
+		}),
+		"send": newNativeFunction([]string{"channel", "value"}, func(ctx context.Context, args []Value) (Value, error) {
+			channel, err := asChannel(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return &NoneValue{}, channel.send(ctx, m, args[1])
+		}),
+		"receive": newNativeFunction([]string{"channel"}, func(ctx context.Context, args []Value) (Value, error) {
+			channel, err := asChannel(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return channel.receive(ctx, m)
+		}),
+		"close": newNativeFunction([]string{"channel"}, func(ctx context.Context, args []Value) (Value, error) {
+			channel, err := asChannel(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return &NoneValue{}, channel.close(ctx, m)
+		}),
+	}
+}
+
+// BuiltinNames returns the names of the builtin functions, sorted.
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range builtins(nil) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newBuiltinsEnv(exec *execution) *Env {
+	env := NewEnv(nil)
+	env.execution = exec
+	for name, function := range builtins(exec.monitor) {
+		function.Name = name
+		env.DefineVariable(name, &FunctionValue{Function: function})
+	}
+	return env
+}
+
+func asChannel(value Value) (*ChannelValue, error) {
+	if value.Type() != VAL_CHANNEL {
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "expected a channel, got %s", value.TypeName())
+	}
+	return value.(*ChannelValue), nil
+}
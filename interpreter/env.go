@@ -1,49 +1,108 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
 	"sync"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
 )
 
+// execution is what every scope of an interpreter shares: how branches run
+// and wait for each other, and what bounds them.
+type execution struct {
+	scheduler *scheduler
+	locks     *locks
+	monitor   *monitor
+	races     *raceDetector
+	budget    *budget
+	memory    *memory
+	// maxCallDepth bounds how deeply function calls nest in a branch.
+	maxCallDepth int
+}
+
 type Env struct {
 	variables *sync.Map
 	parent    *Env
+	// ctx is the execution the scope belongs to. It is inherited from the
+	// parent unless the scope starts a new one, like a fork branch does.
+	ctx context.Context
+	*execution
+	// branch is the branch of ctx, looked up once per scope.
+	branch *branch
 }
 
 func NewEnv(parent *Env) *Env {
-	return &Env{
+	ctx := context.Background()
+	if parent != nil {
+		ctx = parent.ctx
+	}
+	return newEnvWithContext(parent, ctx)
+}
+
+func newEnvWithContext(parent *Env, ctx context.Context) *Env {
+	env := &Env{
 		variables: &sync.Map{},
 		parent:    parent,
+		ctx:       ctx,
+	}
+	if parent != nil {
+		env.execution = parent.execution
+	}
+	if parent != nil && ctx == parent.ctx {
+		env.branch = parent.branch
+	} else {
+		env.branch = branchOf(ctx)
 	}
+	return env
 }
 
-func (e *Env) GetVariable(name string) (Value, error) {
-	if val, ok := e.variables.Load(name); ok {
-		return val.(Value), nil
+// recordAccess tells the race detector, when there is one, about an access
+// made by the code running in e.
+func (e *Env) recordAccess(loc location, name string, write bool) {
+	if e.races != nil {
+		e.races.record(e.ctx, loc, name, write)
+	}
+}
+
+// step accounts for a step of the code running in e: a statement, a loop
+// iteration, a call or a fork branch. It tells whether the execution has to
+// stop there, as it was cancelled, timed out or ran out of steps.
+func (e *Env) step() error {
+	if e.budget.take() {
+		// Blocked branches stop as well, as when a sibling fails.
+		e.monitor.interrupt()
 	}
-	if e.parent != nil {
-		return e.parent.GetVariable(name)
+	return e.ctx.Err()
+}
+
+func (e *Env) GetVariable(name string) (Value, error) {
+	for env := e; env != nil; env = env.parent {
+		if val, ok := env.variables.Load(name); ok {
+			e.recordAccess(location{holder: env, name: name}, name, false)
+			return val.(Value), nil
+		}
 	}
-	return nil, fmt.Errorf("variable '%s' not defined", name)
+	return nil, errors.NewRuntimeError(errors.NAME_ERROR, "variable '%s' not defined", name)
 }
 
 func (e *Env) DefineVariable(name string, val Value) error {
 	_, loaded := e.variables.LoadOrStore(name, val)
 	if loaded {
-		return fmt.Errorf("variable '%s' already defined in this scope", name)
+		return errors.NewRuntimeError(errors.NAME_ERROR, "variable '%s' already defined in this scope", name)
 	}
 	return nil
 }
 
 func (e *Env) AssignVariable(name string, val Value) error {
-	if _, ok := e.variables.Load(name); ok {
-		e.variables.Store(name, val)
-		return nil
-	}
-	if e.parent != nil {
-		return e.parent.AssignVariable(name, val)
+	for env := e; env != nil; env = env.parent {
+		if _, ok := env.variables.Load(name); ok {
+			env.variables.Store(name, val)
+			e.recordAccess(location{holder: env, name: name}, name, true)
+			return nil
+		}
 	}
-	return fmt.Errorf("variable '%s' not defined", name)
+	return errors.NewRuntimeError(errors.NAME_ERROR, "variable '%s' not defined", name)
 }
 
 func (e *Env) AssignArrayVariable(name string, indexes []int, val Value) error {
@@ -56,20 +115,29 @@ func (e *Env) AssignArrayVariable(name string, indexes []int, val Value) error {
 		return err
 	}
 
+	cell := name
 	for i, index := range indexes {
 		if arrayVal.Type() != VAL_ARRAY {
-			return fmt.Errorf("variable '%s' is not an array", name)
+			return errors.NewRuntimeError(errors.TYPE_ERROR, "variable '%s' is not an array", name)
 		}
 		av := arrayVal.(*ArrayValue)
-		if index < 0 || index >= len(av.Values) {
-			return fmt.Errorf("array index %d out of bounds", index)
+		if e.races != nil {
+			cell = fmt.Sprintf("%s[%d]", cell, index)
 		}
 
 		if i == len(indexes)-1 {
-			av.Values[index] = val
-		} else {
-			arrayVal = av.Values[index]
+			if err := av.Set(index, val); err != nil {
+				return err
+			}
+			e.recordAccess(location{holder: av, index: index}, cell, true)
+			return nil
+		}
+
+		arrayVal, err = av.Get(index)
+		if err != nil {
+			return err
 		}
+		e.recordAccess(location{holder: av, index: index}, cell, false)
 	}
 
 	return nil
@@ -0,0 +1,39 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TimeoutErr stops an execution that ran for longer than its timeout. It is
+// a context.DeadlineExceeded too.
+type TimeoutErr struct {
+	Timeout time.Duration
+}
+
+func (e TimeoutErr) Error() string {
+	return fmt.Sprintf("execution timed out after %s", e.Timeout)
+}
+
+func (e TimeoutErr) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+func NewTimeoutErr(timeout time.Duration) TimeoutErr {
+	return TimeoutErr{Timeout: timeout}
+}
+
+// StepLimitErr stops an execution that took more steps than its budget:
+// statements, loop iterations, calls and fork branches.
+type StepLimitErr struct {
+	Steps int64
+}
+
+func (e StepLimitErr) Error() string {
+	return fmt.Sprintf("execution exceeded its budget of %d steps", e.Steps)
+}
+
+func NewStepLimitErr(steps int64) StepLimitErr {
+	return StepLimitErr{Steps: steps}
+}
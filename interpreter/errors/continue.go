@@ -0,0 +1,16 @@
+package errors
+
+type ContinueErr struct{}
+
+func (e ContinueErr) Error() string {
+	return "continue"
+}
+
+func NewContinueErr() ContinueErr {
+	return ContinueErr{}
+}
+
+func IsContinueErr(err error) bool {
+	_, ok := err.(ContinueErr)
+	return ok
+}
@@ -0,0 +1,38 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlockedBranch tells where a branch got stuck and what it is waiting for.
+type BlockedBranch struct {
+	Branch    string
+	Statement string
+	Reason    string
+}
+
+func (b BlockedBranch) String() string {
+	if b.Statement == "" {
+		return fmt.Sprintf("%s: %s", b.Branch, b.Reason)
+	}
+	return fmt.Sprintf("%s, at %s: %s", b.Branch, b.Statement, b.Reason)
+}
+
+// DeadlockErr stops an execution in which every branch is blocked, so none
+// of them could ever go on.
+type DeadlockErr struct {
+	Branches []BlockedBranch
+}
+
+func (e DeadlockErr) Error() string {
+	lines := make([]string, len(e.Branches))
+	for i, branch := range e.Branches {
+		lines[i] = "  " + branch.String()
+	}
+	return fmt.Sprintf("deadlock: every branch is blocked:\n%s", strings.Join(lines, "\n"))
+}
+
+func NewDeadlockErr(branches []BlockedBranch) DeadlockErr {
+	return DeadlockErr{Branches: branches}
+}
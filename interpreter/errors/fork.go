@@ -0,0 +1,57 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+)
+
+// BranchErr is the error a single branch of a fork failed with.
+type BranchErr struct {
+	Index int
+	Err   error
+}
+
+func (e BranchErr) Error() string {
+	return fmt.Sprintf("branch %d: %v", e.Index, e.Err)
+}
+
+func (e BranchErr) Unwrap() error {
+	return e.Err
+}
+
+// ForkErr gathers the failed branches of a fork, by index. Branches that were
+// cancelled because a sibling failed are not listed.
+type ForkErr struct {
+	Branches []BranchErr
+}
+
+func (e ForkErr) Error() string {
+	indexes := make([]string, len(e.Branches))
+	messages := make([]string, len(e.Branches))
+	for i, branch := range e.Branches {
+		indexes[i] = fmt.Sprint(branch.Index)
+		messages[i] = "  " + strings.ReplaceAll(branch.Error(), "\n", "\n  ")
+	}
+	return fmt.Sprintf("fork failed in branches [%s]:\n%s", strings.Join(indexes, ", "), strings.Join(messages, "\n"))
+}
+
+func (e ForkErr) Unwrap() []error {
+	errs := make([]error, len(e.Branches))
+	for i, branch := range e.Branches {
+		errs[i] = branch
+	}
+	return errs
+}
+
+func NewForkErr(branches []BranchErr) ForkErr {
+	return ForkErr{Branches: branches}
+}
+
+// IsCancelledErr reports whether err only tells that the execution was
+// cancelled, as it happens to the branches of a fork when a sibling fails, or
+// that it ran out of time.
+func IsCancelledErr(err error) bool {
+	return stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded)
+}
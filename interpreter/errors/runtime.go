@@ -0,0 +1,162 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+// ErrorKind tells what went wrong in a runtime error.
+type ErrorKind int
+
+const (
+	// TYPE_ERROR is a value of the wrong type for an operation.
+	TYPE_ERROR ErrorKind = iota
+	// NAME_ERROR is a variable that is not defined, or is defined twice.
+	NAME_ERROR
+	// INDEX_ERROR is an array index out of bounds.
+	INDEX_ERROR
+	// ARITHMETIC_ERROR is an operation with no result, as dividing by zero.
+	ARITHMETIC_ERROR
+	// CALL_ERROR is a call of something that is not a function, or with the
+	// wrong number of arguments.
+	CALL_ERROR
+	// VALUE_ERROR is a value of the right type that an operation cannot take.
+	VALUE_ERROR
+	// CHANNEL_ERROR is a send on or close of a closed channel.
+	CHANNEL_ERROR
+	// LOCK_ERROR is a lock taken again by the branch holding it.
+	LOCK_ERROR
+	// RECURSION_ERROR is a chain of calls nested too deeply.
+	RECURSION_ERROR
+	// MEMORY_ERROR is an allocation of more array cells than allowed.
+	MEMORY_ERROR
+)
+
+var errorKindNames = [...]string{
+	TYPE_ERROR:       "TypeError",
+	NAME_ERROR:       "NameError",
+	INDEX_ERROR:      "IndexError",
+	ARITHMETIC_ERROR: "ArithmeticError",
+	CALL_ERROR:       "CallError",
+	VALUE_ERROR:      "ValueError",
+	CHANNEL_ERROR:    "ChannelError",
+	LOCK_ERROR:       "LockError",
+	RECURSION_ERROR:  "RecursionError",
+	MEMORY_ERROR:     "MemoryError",
+}
+
+func (k ErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+// Frame is a step on the way to a runtime error: a call of a function, or a
+// branch of a fork.
+type Frame struct {
+	// Function names the called function. It is empty in the frames of fork
+	// branches.
+	Function string
+	// Site is where the function was called, or where the fork is.
+	Site common.Span
+	// Branch is the index of the branch of the fork.
+	Branch int
+}
+
+func (f Frame) String() string {
+	if f.Function == "" {
+		return fmt.Sprintf("branch %d of the fork at %s", f.Branch, f.Site.Start)
+	}
+	return fmt.Sprintf("%s, called at %s", f.Function, f.Site.Start)
+}
+
+// RuntimeError is an error of the program being run. It tells where it
+// happened, in Span, and how the execution got there, in Frames, innermost
+// first.
+type RuntimeError struct {
+	Kind    ErrorKind
+	Message string
+	Span    common.Span
+	Frames  []Frame
+}
+
+func (e RuntimeError) Error() string {
+	if !e.Located() {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Message)
+}
+
+// Located reports whether the span of the error is known.
+func (e RuntimeError) Located() bool {
+	return e.Span.Start.Line > 0
+}
+
+// NewRuntimeError builds an error of the given kind. Its span is filled in by
+// the node of the program that failed, with At.
+func NewRuntimeError(kind ErrorKind, format string, args ...any) RuntimeError {
+	return RuntimeError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// At locates the runtime errors in err at span, unless they are located
+// already: those come from an inner node.
+func At(err error, span common.Span) error {
+	return mapRuntimeErrors(err, func(e RuntimeError) RuntimeError {
+		if !e.Located() {
+			e.Span = span
+		}
+		return e
+	})
+}
+
+// PositionSpan is the span of a node known only by where it starts.
+func PositionSpan(position common.Position) common.Span {
+	return common.Span{Start: position, End: position}
+}
+
+// WithFrame adds frame to the runtime errors in err, as the outermost one.
+// Frames are added while the error goes up the calls, so they are kept
+// innermost first: however deep the recursion, adding one takes no copy.
+func WithFrame(err error, frame Frame) error {
+	return mapRuntimeErrors(err, func(e RuntimeError) RuntimeError {
+		e.Frames = append(e.Frames, frame)
+		return e
+	})
+}
+
+// mapRuntimeErrors applies f to err, if it is a runtime error, or to the
+// runtime errors of the branches of a failed fork. Other errors are left as
+// they are.
+func mapRuntimeErrors(err error, f func(RuntimeError) RuntimeError) error {
+	switch e := err.(type) {
+	case RuntimeError:
+		return f(e)
+	case ForkErr:
+		branches := make([]BranchErr, len(e.Branches))
+		for i, branch := range e.Branches {
+			branches[i] = BranchErr{Index: branch.Index, Err: mapRuntimeErrors(branch.Err, f)}
+		}
+		return ForkErr{Branches: branches}
+	default:
+		return err
+	}
+}
+
+// RuntimeErrors returns the runtime errors in err: err itself, or those of
+// every failed branch of a fork, however nested.
+func RuntimeErrors(err error) []RuntimeError {
+	var fork ForkErr
+	if stderrors.As(err, &fork) {
+		var errs []RuntimeError
+		for _, branch := range fork.Branches {
+			errs = append(errs, RuntimeErrors(branch.Err)...)
+		}
+		return errs
+	}
+
+	var runtime RuntimeError
+	if stderrors.As(err, &runtime) {
+		return []RuntimeError{runtime}
+	}
+	return nil
+}
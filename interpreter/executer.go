@@ -1,8 +1,11 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/expression"
 	"github.com/Tinchocw/forky/common/statement"
 	"github.com/Tinchocw/forky/common/statement/assignment"
 	"github.com/Tinchocw/forky/common/statement/block"
@@ -30,6 +33,30 @@ func executeStatements(statements []statement.Statement, env *Env) (Value, error
 }
 
 func executeStatement(stmt statement.Statement, env *Env) (Value, error) {
+	// Statement boundaries are where branches take turns, when they do, and
+	// where a cancelled execution stops.
+	env.monitor.yield()
+	if err := env.step(); err != nil {
+		return nil, err
+	}
+
+	if env.branch != nil {
+		previous := env.branch.current.Swap(&stmt)
+		defer env.branch.current.Store(previous)
+	}
+
+	value, err := runStatement(stmt, env)
+	if err != nil {
+		// Statements locate the errors of nodes that cannot. Returns keep
+		// their value.
+		if position, ok := statementPosition(stmt); ok {
+			err = errors.At(err, errors.PositionSpan(position))
+		}
+	}
+	return value, err
+}
+
+func runStatement(stmt statement.Statement, env *Env) (Value, error) {
 	switch s := stmt.(type) {
 	case *block.BlockStatement:
 		return executeBlockStatement(s, env)
@@ -47,6 +74,10 @@ func executeStatement(stmt statement.Statement, env *Env) (Value, error) {
 		return executeForkBlockStatement(s, env)
 	case *extra.ForkArrayStatement:
 		return excecuteForkArrayStatement(s, env)
+	case *extra.LockStatement:
+		return executeLockStatement(s, env)
+	case *extra.SelectStatement:
+		return executeSelectStatement(s, env)
 	case *flow.IfStatement:
 		return executeIfStatement(s, env)
 	case *flow.WhileStatement:
@@ -59,6 +90,8 @@ func executeStatement(stmt statement.Statement, env *Env) (Value, error) {
 		return executeReturnStatement(s, env)
 	case *flow.BreakStatement:
 		return executeBreakStatement(s, env)
+	case *flow.ContinueStatement:
+		return executeContinueStatement(s, env)
 	default:
 		return nil, fmt.Errorf("unknown statement type: %T", stmt)
 	}
@@ -90,7 +123,7 @@ func executeVarDeclaration(stmt *declaration.VarDeclaration, env *Env) (Value, e
 }
 
 func executeArrayDeclaration(stmt *declaration.ArrayDeclaration, env *Env) (Value, error) {
-	lengths := []*IntValue{}
+	lengths := []int{}
 
 	for _, lenExpr := range stmt.Lengths {
 		lenValue, err := resolveExpression(lenExpr, env)
@@ -99,10 +132,14 @@ func executeArrayDeclaration(stmt *declaration.ArrayDeclaration, env *Env) (Valu
 		}
 
 		if lenValue.Type() != VAL_INT {
-			return nil, fmt.Errorf("array length must be an integer, got %s", lenValue.TypeName())
+			return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "array length must be an integer, got %s", lenValue.TypeName())
 		}
 
-		lengths = append(lengths, lenValue.(*IntValue))
+		length := lenValue.(*IntValue).Value
+		if length < 0 {
+			return nil, errors.NewRuntimeError(errors.VALUE_ERROR, "array length must not be negative, got %d", length)
+		}
+		lengths = append(lengths, length)
 	}
 
 	var value Value = &NoneValue{}
@@ -115,6 +152,11 @@ func executeArrayDeclaration(stmt *declaration.ArrayDeclaration, env *Env) (Valu
 		}
 	}
 
+	// Check the size before allocating anything: a huge array would exhaust
+	// the memory of the interpreter.
+	if err := env.memory.allocateArray(lengths); err != nil {
+		return nil, err
+	}
 	array := createArrayRecursive(lengths, value)
 
 	err := env.DefineVariable(stmt.Name, array)
@@ -126,12 +168,12 @@ func executeArrayDeclaration(stmt *declaration.ArrayDeclaration, env *Env) (Valu
 	return nil, nil
 }
 
-func createArrayRecursive(lengths []*IntValue, cellValue Value) Value {
+func createArrayRecursive(lengths []int, cellValue Value) Value {
 	if len(lengths) == 0 {
 		return cellValue
 	}
 
-	size := int(lengths[0].Value)
+	size := lengths[0]
 	array := make([]Value, size)
 	for i := range size {
 		array[i] = createArrayRecursive(lengths[1:], cellValue)
@@ -163,7 +205,7 @@ func executeArrayAssignment(stmt *assignment.ArrayAssignment, env *Env) (Value,
 		}
 
 		if indexValue.Type() != VAL_INT {
-			return nil, fmt.Errorf("array index must be an integer, got %s", indexValue.TypeName())
+			return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "array index must be an integer, got %s", indexValue.TypeName())
 		}
 
 		indexes = append(indexes, int(indexValue.(*IntValue).Value))
@@ -198,69 +240,300 @@ func executePrintStatement(stmt *extra.PrintStatement, env *Env) (Value, error)
 }
 
 func executeForkBlockStatement(stmt *extra.ForkBlockStatement, env *Env) (Value, error) {
-	done := make(chan error)
+	err := runBranches(env, stmt.Position, len(stmt.Block.Statements), func(index int, branchEnv *Env) error {
+		_, err := executeStatement(stmt.Block.Statements[index], branchEnv)
+		return err
+	})
+	return nil, err
+}
 
-	for _, s := range stmt.Block.Statements {
-		newEnv := NewEnv(env)
-		go func(st statement.Statement, e *Env) {
-			_, err := executeStatement(st, e)
-			done <- err
-		}(s, newEnv)
+func excecuteForkArrayStatement(stmt *extra.ForkArrayStatement, env *Env) (Value, error) {
+	_, err := forkArray(env, "fork array statement", stmt.Position, stmt.Array, stmt.IndexName, stmt.ElemName, stmt.Block, false)
+	return nil, err
+}
+
+// forkArray runs body in a branch for every element of the array, with the
+// index and element names defined as asked. With collect, it gives the value
+// each branch returned, or none, in index order; their cells are allocated
+// from the memory of the execution before any branch runs.
+func forkArray(env *Env, construct string, position common.Position, array expression.Expression, indexName *string, elemName *string, body *block.BlockStatement, collect bool) ([]Value, error) {
+	value, err := resolveExpression(array, env)
+	if err != nil {
+		return nil, err
 	}
 
-	for range stmt.Block.Statements {
-		if err := <-done; err != nil {
+	if value.Type() != VAL_ARRAY {
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "expected array type in %s, got %s", construct, value.TypeName())
+	}
+
+	arrayValue := value.(*ArrayValue).Elements()
+	var results []Value
+	if collect {
+		if err := env.memory.allocate(len(arrayValue)); err != nil {
 			return nil, err
 		}
+		results = make([]Value, len(arrayValue))
 	}
 
-	return nil, nil
+	err = runBranches(env, position, len(arrayValue), func(index int, branchEnv *Env) error {
+		if indexName != nil {
+			if err := branchEnv.DefineVariable(*indexName, &IntValue{Value: index}); err != nil {
+				return err
+			}
+		}
+
+		if elemName != nil {
+			if err := branchEnv.DefineVariable(*elemName, arrayValue[index]); err != nil {
+				return err
+			}
+		}
+
+		result, err := executeBlockStatement(body, branchEnv)
+		if errors.IsReturnErr(err) {
+			err = nil
+		} else {
+			result = nil
+		}
+
+		if collect {
+			if result == nil {
+				result = &NoneValue{}
+			}
+			results[index] = result
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
-func excecuteForkArrayStatement(stmt *extra.ForkArrayStatement, env *Env) (Value, error) {
-	value, err := resolveExpression(stmt.Array, env)
+// reduceGrain is the fewest elements a fork reduce splits in a fork. Fewer
+// are combined one after the other, which costs less than forking for them.
+const reduceGrain = 64
+
+// forkReduce combines elements with combine, which should be associative:
+// it splits them in halves, reduces both in a fork of two branches and
+// combines their results. Runs of at most grain elements are combined in
+// order instead. identity is the result of no elements at all.
+func forkReduce(env *Env, position common.Position, elements []Value, identity Value, combine Function, grain int) (Value, error) {
+	if len(elements) == 0 {
+		return identity, nil
+	}
+
+	if len(elements) <= grain {
+		result := elements[0]
+		for _, element := range elements[1:] {
+			var err error
+			if result, err = combineReduced(env, position, combine, result, element); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+
+	half := len(elements) / 2
+	halves := [][]Value{elements[:half], elements[half:]}
+	results := make([]Value, len(halves))
+
+	err := runBranches(env, position, len(halves), func(index int, branchEnv *Env) error {
+		result, err := forkReduce(branchEnv, position, halves[index], identity, combine, grain)
+		results[index] = result
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return combineReduced(env, position, combine, results[0], results[1])
+}
 
-	if value.Type() != VAL_ARRAY {
-		return nil, fmt.Errorf("expected array type in fork array statement, got %s", value.TypeName())
+// combineReduced calls the combining function of a fork reduce with two of
+// its partial results.
+func combineReduced(env *Env, position common.Position, combine Function, left Value, right Value) (Value, error) {
+	result, err := combine.Call(env.ctx, []Value{left, right})
+	if err != nil && !errors.IsReturnErr(err) {
+		return nil, errors.WithFrame(err, errors.Frame{Function: combine.Name, Site: errors.PositionSpan(position)})
 	}
+	// A combining function that returns nothing gives none.
+	if result == nil {
+		result = &NoneValue{}
+	}
+	return result, nil
+}
 
-	arrayValue := value.(*ArrayValue).Values
+func executeLockStatement(stmt *extra.LockStatement, env *Env) (Value, error) {
+	name := atomicLock
+	if stmt.Name != nil {
+		name = *stmt.Name
+	}
 
-	done := make(chan error)
+	return holdLock(env, name, func(lockedEnv *Env) (Value, error) {
+		return executeStatements(stmt.Block.Statements, lockedEnv)
+	})
+}
 
-	for index, elem := range arrayValue {
-		newEnv := NewEnv(env)
+func executeSelectStatement(stmt *extra.SelectStatement, env *Env) (Value, error) {
+	channels := make([]*ChannelValue, len(stmt.Cases))
+	messages := make([]message, len(stmt.Cases))
+	var receiving *ticket
+	clock := clockOf(env.ctx)
 
-		if stmt.IndexName != nil {
-			err := newEnv.DefineVariable(*stmt.IndexName, &IntValue{Value: index})
-			if err != nil {
-				return nil, err
+	for i, c := range stmt.Cases {
+		value, err := resolveExpression(c.Channel, env)
+		if err != nil {
+			return nil, err
+		}
+		if channels[i], err = asChannel(value); err != nil {
+			return nil, err
+		}
+
+		if c.Value == nil {
+			if receiving == nil {
+				receiving = newTicket(nil)
 			}
+			receiving.channels = append(receiving.channels, channels[i])
+			continue
+		}
+		if messages[i].value, err = resolveExpression(c.Value, env); err != nil {
+			return nil, err
 		}
+		messages[i].clock = clock.snapshot()
+	}
 
-		if stmt.ElemName != nil {
-			err := newEnv.DefineVariable(*stmt.ElemName, elem)
-			if err != nil {
-				return nil, err
+	// try goes on with the case a sender handed a value to, if any, or else
+	// with the first case, in order, that can.
+	chosen := -1
+	var received message
+	var sendErr error
+	try := func() bool {
+		for i, c := range stmt.Cases {
+			if receiving != nil && receiving.filled && c.Value == nil && channels[i] == receiving.from {
+				chosen = i
+				received = receiving.message
+				return true
 			}
 		}
+		for i, c := range stmt.Cases {
+			var ok bool
+			if c.Value == nil {
+				received, ok = channels[i].tryReceive()
+			} else {
+				ok, sendErr = channels[i].trySend(messages[i], receiving)
+			}
+			if ok {
+				chosen = i
+				return true
+			}
+		}
+		return false
+	}
+
+	if stmt.Default != nil {
+		env.monitor.mu.Lock()
+		if try() {
+			env.monitor.wake()
+		}
+		env.monitor.mu.Unlock()
 
-		go func(e *Env) {
-			_, err := executeBlockStatement(stmt.Block, e)
-			done <- err
-		}(newEnv)
+		if chosen < 0 {
+			return executeBlockStatement(stmt.Default, env)
+		}
+	} else if err := env.monitor.block(env.ctx, "waiting in a select", receiving, try); err != nil {
+		return nil, err
+	}
+
+	if sendErr != nil {
+		return nil, sendErr
 	}
 
-	for range arrayValue {
-		if err := <-done; err != nil {
+	c := stmt.Cases[chosen]
+	if c.Value == nil {
+		clock.merge(received.clock)
+	} else {
+		clock.tick()
+	}
+	caseEnv := NewEnv(env)
+	if c.Name != nil {
+		if err := caseEnv.DefineVariable(*c.Name, received.value); err != nil {
 			return nil, err
 		}
 	}
+	return executeStatements(c.Body.Statements, caseEnv)
+}
+
+// runBranches runs count branches of a fork, each in a scope of its own, on
+// the scheduler of the execution and waits for all of them. The first
+// failure cancels the other branches, which stop at their next statement,
+// and the error lists every branch that failed.
+func runBranches(env *Env, position common.Position, count int, body func(index int, branchEnv *Env) error) error {
+	ctx, cancel := context.WithCancel(env.ctx)
+	defer cancel()
+
+	var fork int64
+	var base vectorClock
+	var clocks []*clock
+	if env.races != nil {
+		fork = env.races.newFork()
+		// The branches start from what the forking code knows, and what it
+		// does from now on is news to them.
+		parent := clockOf(env.ctx)
+		base = parent.snapshot()
+		parent.tick()
+		clocks = make([]*clock, count)
+	}
+
+	errs := make([]error, count)
+	var depth int
+	if env.branch != nil {
+		depth = env.branch.depth
+	}
+	reason := fmt.Sprintf("waiting for the branches of the fork at %s", position)
+	env.scheduler.run(env.ctx, env.monitor, reason, count, func(index int) {
+		branchCtx := withNewBranch(ctx, &branch{parent: env.branch, fork: position, index: index, depth: depth})
+		if env.races != nil {
+			branchCtx = withBranch(branchCtx, forkBranch{fork: fork, index: index, position: position})
+			clocks[index] = env.races.newClock(base)
+			branchCtx = withClock(branchCtx, clocks[index])
+		}
+
+		branchEnv := newEnvWithContext(env, branchCtx)
+		err := branchEnv.step()
+		if err == nil {
+			err = body(index, branchEnv)
+		}
+		if err != nil {
+			errs[index] = errors.WithFrame(err, errors.Frame{Site: errors.PositionSpan(position), Branch: index})
+			cancel()
+			env.monitor.interrupt()
+		}
+	})
+
+	if env.races != nil {
+		parent := clockOf(env.ctx)
+		for _, c := range clocks {
+			if c != nil {
+				parent.merge(c.times)
+			}
+		}
+		if len(taskOf(env.ctx)) == 0 {
+			env.races.joined()
+		}
+	}
 
-	return nil, nil
+	var failed []errors.BranchErr
+	for index, err := range errs {
+		if err != nil && !errors.IsCancelledErr(err) {
+			failed = append(failed, errors.BranchErr{Index: index, Err: err})
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.NewForkErr(failed)
+	}
+
+	// Nothing failed here, but the fork itself may belong to a cancelled branch.
+	return env.ctx.Err()
 }
 
 func executeIfStatement(stmt *flow.IfStatement, env *Env) (Value, error) {
@@ -294,6 +567,11 @@ func executeIfStatement(stmt *flow.IfStatement, env *Env) (Value, error) {
 
 func executeWhileStatement(stmt *flow.WhileStatement, env *Env) (Value, error) {
 	for {
+		// Even an empty body has to stop with the execution.
+		if err := env.step(); err != nil {
+			return nil, err
+		}
+
 		conditionValue, err := resolveExpression(stmt.Condition, env)
 		if err != nil {
 			return nil, err
@@ -307,6 +585,8 @@ func executeWhileStatement(stmt *flow.WhileStatement, env *Env) (Value, error) {
 		if err != nil {
 			if errors.IsBreakErr(err) {
 				break
+			} else if errors.IsContinueErr(err) {
+				continue
 			} else {
 				return result, err
 			}
@@ -317,7 +597,7 @@ func executeWhileStatement(stmt *flow.WhileStatement, env *Env) (Value, error) {
 }
 
 func executeFunctionDef(stmt *function.FunctionDef, env *Env) (Value, error) {
-	function := NewFunction(stmt.Parameters, stmt.Body.Statements)
+	function := NewFunction(*stmt.Name, stmt.Parameters, stmt.Body.Statements, env)
 	err := env.DefineVariable(*stmt.Name, &FunctionValue{Function: function})
 	if err != nil {
 		return nil, err
@@ -346,3 +626,7 @@ func executeReturnStatement(stmt *function.ReturnStatement, env *Env) (Value, er
 func executeBreakStatement(_ *flow.BreakStatement, _ *Env) (Value, error) {
 	return nil, errors.NewBreakErr()
 }
+
+func executeContinueStatement(_ *flow.ContinueStatement, _ *Env) (Value, error) {
+	return nil, errors.NewContinueErr()
+}
@@ -1,29 +1,72 @@
 package interpreter
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/Tinchocw/forky/common/statement"
+	"github.com/Tinchocw/forky/interpreter/errors"
 )
 
 type Function struct {
+	// Name is how tracebacks call the function.
+	Name       string
 	Parameters []string
 	Statements []statement.Statement
+	// Closure is the environment the function was defined in. Its body sees
+	// the variables of that scope, not the ones of whoever calls it.
+	Closure *Env
+	// native implements builtin functions in Go instead of statements.
+	native func(ctx context.Context, args []Value) (Value, error)
 }
 
-func NewFunction(params []string, statements []statement.Statement) Function {
+// anonymousFunction names the functions made by function literals.
+const anonymousFunction = "anonymous function"
+
+func NewFunction(name string, params []string, statements []statement.Statement, closure *Env) Function {
 	return Function{
+		Name:       name,
 		Parameters: params,
 		Statements: statements,
+		Closure:    closure,
+	}
+}
+
+func newNativeFunction(params []string, native func(ctx context.Context, args []Value) (Value, error)) Function {
+	return Function{
+		Parameters: params,
+		native:     native,
 	}
 }
 
-func (f Function) Call(args []Value, env *Env) (Value, error) {
+// Call runs the function within ctx, the execution of its caller.
+func (f Function) Call(ctx context.Context, args []Value) (Value, error) {
 	if len(args) != len(f.Parameters) {
-		return nil, fmt.Errorf("expected %d arguments, got %d", len(f.Parameters), len(args))
+		return nil, errors.NewRuntimeError(errors.CALL_ERROR, "expected %d arguments, got %d", len(f.Parameters), len(args))
 	}
 
-	functionEnv := NewEnv(env)
+	if f.native != nil {
+		value, err := f.native(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		// Builtins end the way functions returning a value do.
+		return value, errors.NewReturnErr()
+	}
+
+	functionEnv := newEnvWithContext(f.Closure, ctx)
+	if err := functionEnv.step(); err != nil {
+		return nil, err
+	}
+
+	// Calls nest on the Go stack of the branch making them, so recursion has
+	// to stop before it overflows that stack.
+	if b := functionEnv.branch; b != nil && functionEnv.maxCallDepth > 0 {
+		if b.depth >= functionEnv.maxCallDepth {
+			return nil, errors.NewRuntimeError(errors.RECURSION_ERROR, "maximum recursion depth exceeded (%d nested calls)", functionEnv.maxCallDepth)
+		}
+		b.depth++
+		defer func() { b.depth-- }()
+	}
 	for idx, argValue := range args {
 		functionEnv.DefineVariable(f.Parameters[idx], argValue)
 	}
@@ -1,21 +1,182 @@
 package interpreter
 
-import "github.com/Tinchocw/forky/common/statement"
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/Tinchocw/forky/common/statement"
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
 
 type Interpreter struct {
-	globalEnv *Env
+	globalEnv   *Env
+	forkWorkers int
+	// forkWorkersSet tells forkWorkers was chosen rather than defaulted.
+	forkWorkersSet bool
+	detectRaces    bool
+	turns          *turns
+	maxCallDepth   int
+	timeout        time.Duration
+	maxSteps       int64
+	// maxArrayCells and maxCells bound the array cells of a declaration and
+	// of a whole execution.
+	maxArrayCells int
+	maxCells      int
+}
+
+// DefaultMaxCallDepth is how deeply function calls may nest in a branch
+// unless WithMaxCallDepth says otherwise. It is far from overflowing the Go
+// stack of a goroutine.
+const DefaultMaxCallDepth = 10000
+
+// DefaultMaxArrayCells is how many cells an array declaration may allocate
+// unless WithMaxArrayCells says otherwise: a few hundred megabytes.
+const DefaultMaxArrayCells = 1 << 24
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithForkWorkers bounds how many goroutines run the branches of forks at
+// once, blocked ones aside. It is runtime.GOMAXPROCS(0) by default. Zero or
+// less runs every branch in a goroutine of its own.
+func WithForkWorkers(workers int) Option {
+	return func(i *Interpreter) {
+		i.forkWorkers = workers
+		i.forkWorkersSet = true
+	}
+}
+
+// WithRaceDetection records the variables and array cells accessed by fork
+// branches and reports the conflicting ones through Races.
+func WithRaceDetection() Option {
+	return func(i *Interpreter) {
+		i.detectRaces = true
+	}
+}
+
+// WithDeterministicScheduling runs one goroutine at a time and switches
+// between fork branches at statement boundaries in an order given by seed.
+// Running a program again with the same seed interleaves its branches, and
+// so prints, the same way. Unless WithForkWorkers says otherwise, every branch
+// gets a goroutine of its own, so that the interleavings a seed gives do not
+// depend on the number of CPUs.
+func WithDeterministicScheduling(seed int64) Option {
+	return func(i *Interpreter) {
+		i.turns = newTurns(seed)
+	}
+}
+
+// WithMaxCallDepth bounds how deeply function calls may nest in a branch,
+// counting those of the code that forked it. Deeper calls fail with a
+// RecursionError. Zero or less keeps DefaultMaxCallDepth.
+func WithMaxCallDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxCallDepth = depth
+	}
+}
+
+// WithTimeout stops every execution that runs for longer than timeout with a
+// TimeoutErr. Zero or less lets executions run for as long as they take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(i *Interpreter) {
+		i.timeout = timeout
+	}
+}
+
+// WithMaxSteps stops every execution that takes more than steps steps with a
+// StepLimitErr. Statements, loop iterations, function calls and fork branches
+// are steps, counted across every branch. Zero or less sets no limit.
+func WithMaxSteps(steps int64) Option {
+	return func(i *Interpreter) {
+		i.maxSteps = steps
+	}
+}
+
+// WithMaxArrayCells bounds the cells a single array declaration allocates,
+// counting those of every dimension: var m[10][10] takes 110. Larger arrays
+// fail with a MemoryError. Zero or less keeps DefaultMaxArrayCells.
+func WithMaxArrayCells(cells int) Option {
+	return func(i *Interpreter) {
+		i.maxArrayCells = cells
+	}
 }
 
-func NewInterpreter() Interpreter {
-	return Interpreter{
-		globalEnv: NewEnv(nil),
+// WithMaxAllocatedCells bounds the array cells every execution allocates in
+// all, by declarations, array literals and fork expressions, whether they are
+// still in use or not. Going over fails with a MemoryError. Zero or less sets
+// no limit.
+func WithMaxAllocatedCells(cells int) Option {
+	return func(i *Interpreter) {
+		i.maxCells = cells
 	}
 }
 
+func NewInterpreter(options ...Option) Interpreter {
+	i := Interpreter{}
+	for _, option := range options {
+		option(&i)
+	}
+	if !i.forkWorkersSet && i.turns == nil {
+		i.forkWorkers = runtime.GOMAXPROCS(0)
+	}
+	if i.maxCallDepth <= 0 {
+		i.maxCallDepth = DefaultMaxCallDepth
+	}
+	if i.maxArrayCells <= 0 {
+		i.maxArrayCells = DefaultMaxArrayCells
+	}
+
+	exec := &execution{
+		scheduler:    newScheduler(i.forkWorkers),
+		locks:        newLocks(),
+		monitor:      newMonitor(i.turns),
+		budget:       newBudget(i.maxSteps),
+		memory:       newMemory(i.maxArrayCells, i.maxCells),
+		maxCallDepth: i.maxCallDepth,
+	}
+	if i.detectRaces {
+		exec.races = newRaceDetector()
+	}
+	i.globalEnv = NewEnv(newBuiltinsEnv(exec))
+	return i
+}
+
+// Execute runs program to its end, or until the timeout or step limit of the
+// interpreter stops it.
 func (i *Interpreter) Execute(program statement.Program) (string, error) {
+	return i.ExecuteContext(context.Background(), program)
+}
+
+// ExecuteContext runs program like Execute does, and also stops it when ctx is
+// done. Every branch stops at its next step then, and the error is the cause
+// of ctx: context.Canceled, context.DeadlineExceeded or the one given to its
+// cancel function.
+func (i *Interpreter) ExecuteContext(ctx context.Context, program statement.Program) (string, error) {
+	if i.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, i.timeout, errors.NewTimeoutErr(i.timeout))
+		defer cancelTimeout()
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	ctx = withNewBranch(ctx, &branch{})
+	i.globalEnv.ctx = ctx
+	i.globalEnv.branch = branchOf(ctx)
+	i.globalEnv.monitor.begin(cancel)
+	i.globalEnv.budget.begin(cancel)
+	i.globalEnv.memory.begin()
+	defer i.globalEnv.monitor.end()
+
 	value, err := executeStatements(program.Statements, i.globalEnv)
 
 	if err != nil {
+		// A deadlock, a timeout or the step limit cancels every branch; tell
+		// why instead of that.
+		if cause := context.Cause(ctx); cause != nil && errors.IsCancelledErr(err) {
+			return "", cause
+		}
 		return "", err
 	}
 
@@ -29,3 +190,12 @@ func (i *Interpreter) Execute(program statement.Program) (string, error) {
 func (i *Interpreter) GetGlobalVariables() []string {
 	return i.globalEnv.GetVariables()
 }
+
+// Races returns the data races found since the last call. It is always empty
+// unless the interpreter was created WithRaceDetection.
+func (i *Interpreter) Races() []Race {
+	if i.globalEnv.races == nil {
+		return nil
+	}
+	return i.globalEnv.races.takeRaces()
+}
@@ -0,0 +1,101 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// atomicLock names the lock shared by every atomic block. No lock statement
+// can name it, since identifiers are never empty.
+const atomicLock = ""
+
+// lock is taken and released under the monitor, which is where branches
+// wait for it: unlike for a sync.Mutex, waiting can be given up when the
+// execution is cancelled, and counts towards detecting deadlocks.
+type lock struct {
+	held bool
+}
+
+func (l *lock) acquire(ctx context.Context, m *monitor, name string) error {
+	return m.block(ctx, "waiting for "+lockDescription(name), nil, func() bool {
+		if l.held {
+			return false
+		}
+		l.held = true
+		return true
+	})
+}
+
+func (l *lock) release(m *monitor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.held = false
+	m.wake()
+}
+
+// locks holds the locks of an interpreter, created the first time they are
+// used.
+type locks struct {
+	mu    sync.Mutex
+	named map[string]*lock
+}
+
+func newLocks() *locks {
+	return &locks{named: map[string]*lock{}}
+}
+
+func (l *locks) get(name string) *lock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	named, ok := l.named[name]
+	if !ok {
+		named = &lock{}
+		l.named[name] = named
+	}
+	return named
+}
+
+// heldKey keys the names of the locks held by the code running within a
+// context, including the ones held by the code that forked it.
+type heldKey struct{}
+
+func heldLocks(ctx context.Context) []string {
+	held, _ := ctx.Value(heldKey{}).([]string)
+	return held
+}
+
+func withHeldLock(ctx context.Context, name string) context.Context {
+	parent := heldLocks(ctx)
+	held := make([]string, len(parent), len(parent)+1)
+	copy(held, parent)
+	return context.WithValue(ctx, heldKey{}, append(held, name))
+}
+
+func lockDescription(name string) string {
+	if name == atomicLock {
+		return "the atomic lock"
+	}
+	return fmt.Sprintf("lock '%s'", name)
+}
+
+// holdLock runs body holding the named lock, and releases it however body
+// ends. Taking a lock already held by the branch, or by the code that forked
+// it and is now waiting for the join, would never succeed.
+func holdLock(env *Env, name string, body func(lockedEnv *Env) (Value, error)) (Value, error) {
+	if slices.Contains(heldLocks(env.ctx), name) {
+		return nil, errors.NewRuntimeError(errors.LOCK_ERROR, "%s is already held by this branch or the code that forked it", lockDescription(name))
+	}
+
+	l := env.locks.get(name)
+	if err := l.acquire(env.ctx, env.monitor, name); err != nil {
+		return nil, err
+	}
+	defer l.release(env.monitor)
+
+	return body(newEnvWithContext(env, withHeldLock(env.ctx, name)))
+}
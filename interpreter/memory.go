@@ -0,0 +1,71 @@
+package interpreter
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// memory accounts for the array cells an execution allocates, so that a
+// program asking for too many fails before it exhausts the memory of the
+// interpreter. Every element of an array is a cell, whatever its dimension.
+// Cells are never given back: the limit bounds what an execution allocates in
+// all, not what it holds at once.
+type memory struct {
+	// maxArrayCells bounds the cells of a single array declaration.
+	maxArrayCells int
+	// maxCells, when positive, bounds the cells of the whole execution.
+	maxCells int
+	cells    atomic.Int64
+}
+
+func newMemory(maxArrayCells, maxCells int) *memory {
+	return &memory{maxArrayCells: maxArrayCells, maxCells: maxCells}
+}
+
+// begin starts counting the cells of an execution.
+func (m *memory) begin() {
+	if m != nil {
+		m.cells.Store(0)
+	}
+}
+
+// allocateArray accounts for an array declared with the given lengths, which
+// are not negative. Each of its dimensions allocates an element for every
+// element of the one before.
+func (m *memory) allocateArray(lengths []int) error {
+	if m == nil {
+		return nil
+	}
+
+	cells, rows := 0, 1
+	for _, length := range lengths {
+		if length > 0 && rows > math.MaxInt/length {
+			return m.arrayTooLarge()
+		}
+		rows *= length
+		cells += rows
+		if cells < 0 || cells > m.maxArrayCells {
+			return m.arrayTooLarge()
+		}
+	}
+	return m.allocate(cells)
+}
+
+func (m *memory) arrayTooLarge() error {
+	return errors.NewRuntimeError(errors.MEMORY_ERROR, "array too large: it needs more than %d cells", m.maxArrayCells)
+}
+
+// allocate accounts for cells allocated by the execution, unless they are
+// more than it has left.
+func (m *memory) allocate(cells int) error {
+	if m == nil || m.maxCells <= 0 {
+		return nil
+	}
+	if m.cells.Add(int64(cells)) > int64(m.maxCells) {
+		m.cells.Add(-int64(cells))
+		return errors.NewRuntimeError(errors.MEMORY_ERROR, "execution allocated more than %d array cells", m.maxCells)
+	}
+	return nil
+}
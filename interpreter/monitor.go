@@ -0,0 +1,300 @@
+package interpreter
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// waiter is a goroutine blocked until its try succeeds.
+type waiter struct {
+	ctx    context.Context
+	branch *branch
+	thread *thread
+	reason string
+	try    func() bool
+	// receiving, when set, lets senders on the channels the waiter would
+	// take a value from hand it over, even when they have no buffer.
+	receiving *ticket
+	woken     chan struct{}
+	done      bool
+	// err tells why the waiter stopped waiting without its try succeeding.
+	err error
+}
+
+// monitor knows which goroutines of an execution are running and which are
+// blocked, and on what. Blocking operations retry under its lock whenever
+// something changes, so a goroutine never waits while it could go on, and
+// when no goroutine is running while some are blocked none of them ever
+// will: the execution is cancelled with a DeadlockErr.
+type monitor struct {
+	mu      sync.Mutex
+	running int
+	waiters []*waiter
+	// joiners wait for the branches of a fork. Only the exit of those
+	// branches lets them go on, so wake leaves them alone.
+	joiners map[*waiter]struct{}
+	// tasks are the forks with chunks of branches that no goroutine has taken
+	// yet, oldest first.
+	tasks  []*task
+	cancel context.CancelCauseFunc
+	// turns, when set, runs one goroutine at a time in a seeded order.
+	turns *turns
+}
+
+func newMonitor(turns *turns) *monitor {
+	return &monitor{joiners: map[*waiter]struct{}{}, turns: turns}
+}
+
+// begin starts monitoring an execution run by the calling goroutine, which
+// cancel stops.
+func (m *monitor) begin(cancel context.CancelCauseFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running = 1
+	m.waiters = nil
+	clear(m.joiners)
+	m.tasks = nil
+	m.cancel = cancel
+	m.turns.reset()
+}
+
+func (m *monitor) end() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running = 0
+	m.cancel = nil
+}
+
+// group counts the goroutines running the branches of a fork.
+type group struct {
+	remaining int
+	joiner    *waiter
+}
+
+// spawn runs f in a goroutine of g, counted as running from now on.
+func (m *monitor) spawn(g *group, f func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spawnLocked(g, f)
+}
+
+func (m *monitor) spawnLocked(g *group, f func()) {
+	m.running++
+	g.remaining++
+	th := m.turns.spawn()
+
+	go func() {
+		defer m.exit(g)
+		th.await()
+		f()
+	}()
+}
+
+// offer lets goroutines of their own take the chunks of t, as workers allow.
+func (m *monitor) offer(t *task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = append(m.tasks, t)
+	m.fill()
+}
+
+// withdraw forgets t, whose chunks have all been taken.
+func (m *monitor) withdraw(t *task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = slices.DeleteFunc(m.tasks, func(other *task) bool {
+		return other == t
+	})
+}
+
+// fill starts a goroutine for a pending chunk while fewer goroutines than
+// workers are running. It is called whenever one stops running: a branch
+// blocked on a sibling that has not started yet lets it start.
+func (m *monitor) fill() {
+	for len(m.tasks) > 0 {
+		t := m.tasks[0]
+		if m.running >= t.workers {
+			return
+		}
+		chunk, ok := t.take()
+		if !ok {
+			m.tasks = m.tasks[1:]
+			continue
+		}
+		m.spawnLocked(t.group, func() {
+			t.work(chunk)
+		})
+	}
+}
+
+func (m *monitor) exit(g *group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g.remaining--
+	m.running--
+	if g.remaining == 0 && g.joiner != nil {
+		delete(m.joiners, g.joiner)
+		m.running++
+		m.turns.ready(g.joiner.thread)
+		close(g.joiner.woken)
+	}
+	m.fill()
+	m.turns.suspend()
+	m.detect()
+}
+
+// join waits, within the execution of ctx, for every goroutine of g. Even
+// when ctx is cancelled: the branches stop by themselves.
+func (m *monitor) join(ctx context.Context, g *group, reason string) {
+	m.mu.Lock()
+	if g.remaining == 0 {
+		m.mu.Unlock()
+		return
+	}
+
+	joiner := &waiter{branch: branchOf(ctx), reason: reason, woken: make(chan struct{})}
+	g.joiner = joiner
+	m.joiners[joiner] = struct{}{}
+	m.running--
+	joiner.thread = m.turns.suspend()
+	m.fill()
+	m.detect()
+	m.mu.Unlock()
+
+	<-joiner.woken
+	joiner.thread.await()
+}
+
+// block runs try under the monitor lock until it succeeds. Meanwhile the
+// calling goroutine counts as blocked for reason, and senders on the
+// channels of receiving may fill it. It gives up when ctx is done, unless
+// try succeeded first.
+func (m *monitor) block(ctx context.Context, reason string, receiving *ticket, try func() bool) error {
+	m.mu.Lock()
+	if try() {
+		m.wake()
+		m.mu.Unlock()
+		return nil
+	}
+
+	w := &waiter{ctx: ctx, branch: branchOf(ctx), reason: reason, try: try, receiving: receiving, woken: make(chan struct{})}
+	if receiving != nil {
+		for _, channel := range receiving.channels {
+			channel.receivers = append(channel.receivers, receiving)
+		}
+	}
+	m.waiters = append(m.waiters, w)
+	m.running--
+	w.thread = m.turns.suspend()
+	// New receivers may let blocked senders go on, and so the waiter itself.
+	m.wake()
+	m.fill()
+	m.detect()
+	m.mu.Unlock()
+
+	select {
+	case <-w.woken:
+	case <-ctx.Done():
+		m.mu.Lock()
+		if !w.done {
+			m.stop(w, ctx.Err())
+		}
+		m.mu.Unlock()
+	}
+	w.thread.await()
+	return w.err
+}
+
+// yield lets another goroutine run, if the turns say so, at a statement
+// boundary of the calling one.
+func (m *monitor) yield() {
+	if m.turns == nil {
+		return
+	}
+	m.mu.Lock()
+	th := m.turns.yield()
+	m.mu.Unlock()
+	th.await()
+}
+
+// interrupt stops the waiters whose context is done, as if they noticed
+// themselves. Noticing it here keeps the order the turns give them.
+func (m *monitor) interrupt() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.interruptLocked()
+}
+
+func (m *monitor) interruptLocked() {
+	for _, w := range slices.Clone(m.waiters) {
+		if err := w.ctx.Err(); err != nil {
+			m.stop(w, err)
+			close(w.woken)
+		}
+	}
+}
+
+// stop lets w run again, whether its try succeeded or, with err, not.
+func (m *monitor) stop(w *waiter, err error) {
+	w.done = true
+	w.err = err
+	m.remove(w)
+	m.running++
+	m.turns.ready(w.thread)
+}
+
+func (m *monitor) remove(w *waiter) {
+	m.waiters = slices.DeleteFunc(m.waiters, func(other *waiter) bool {
+		return other == w
+	})
+	if w.receiving == nil {
+		return
+	}
+	for _, channel := range w.receiving.channels {
+		channel.receivers = slices.DeleteFunc(channel.receivers, func(other *ticket) bool {
+			return other == w.receiving
+		})
+	}
+}
+
+// wake hands over to every waiter whose try now succeeds, oldest first. Each
+// success may let others go on, so it repeats until none does.
+func (m *monitor) wake() {
+	for progress := true; progress; {
+		progress = false
+		for _, w := range m.waiters {
+			if w.try() {
+				m.stop(w, nil)
+				close(w.woken)
+				progress = true
+				break
+			}
+		}
+	}
+}
+
+func (m *monitor) detect() {
+	if m.running > 0 || len(m.waiters)+len(m.joiners) == 0 || m.cancel == nil {
+		return
+	}
+
+	waiters := slices.Clone(m.waiters)
+	for w := range m.joiners {
+		waiters = append(waiters, w)
+	}
+	sort.SliceStable(waiters, func(i, j int) bool {
+		return waiters[i].branch.before(waiters[j].branch)
+	})
+
+	branches := make([]errors.BlockedBranch, len(waiters))
+	for i, w := range waiters {
+		branches[i] = errors.BlockedBranch{Branch: w.branch.String(), Statement: w.branch.statement(), Reason: w.reason}
+	}
+	m.cancel(errors.NewDeadlockErr(branches))
+	m.cancel = nil
+	m.interruptLocked()
+}
@@ -0,0 +1,78 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	interpreterErrors "github.com/Tinchocw/forky/interpreter/errors"
+)
+
+func TestJoinWaitsForTheLastBranch(t *testing.T) {
+	m, ctx := newTestMonitor(t)
+
+	const count = 100
+	release := make(chan struct{})
+	g := &group{}
+	for range count {
+		m.spawn(g, func() {
+			<-release
+		})
+	}
+
+	joined := make(chan struct{})
+	go func() {
+		m.join(ctx, g, "joining")
+		close(joined)
+	}()
+
+	// The joiner is kept apart from the waiters: the exit of its branches
+	// lets it go on, not retrying it whenever some goroutine wakes the others.
+	for {
+		m.mu.Lock()
+		joining := len(m.joiners)
+		waiters := len(m.waiters)
+		m.mu.Unlock()
+		if joining == 1 {
+			if waiters != 0 {
+				t.Errorf("got %d waiters while joining, want none", waiters)
+			}
+			break
+		}
+		runtime.Gosched()
+	}
+	select {
+	case <-joined:
+		t.Fatal("joined before the branches exited")
+	default:
+	}
+
+	close(release)
+	<-joined
+	if err := context.Cause(ctx); err != nil {
+		t.Errorf("cancelled with %v", err)
+	}
+}
+
+func TestJoinDeadlock(t *testing.T) {
+	m, ctx := newTestMonitor(t)
+
+	g := &group{}
+	m.spawn(g, func() {
+		m.block(ctx, "waiting forever", nil, func() bool { return false })
+	})
+	m.join(ctx, g, "joining")
+
+	var deadlock interpreterErrors.DeadlockErr
+	if !errors.As(context.Cause(ctx), &deadlock) {
+		t.Fatalf("got cause %v, want a deadlock", context.Cause(ctx))
+	}
+	reasons := map[string]bool{}
+	for _, branch := range deadlock.Branches {
+		reasons[branch.Reason] = true
+	}
+	if len(deadlock.Branches) != 2 || !reasons["joining"] || !reasons["waiting forever"] {
+		t.Errorf("got blocked branches %v, want the joiner and the branch it waits for", deadlock.Branches)
+	}
+}
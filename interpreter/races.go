@@ -0,0 +1,274 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+// forkBranch identifies a branch of a single execution of a fork.
+type forkBranch struct {
+	fork     int64
+	index    int
+	position common.Position
+}
+
+// taskKey keys the branches, outermost first, that lead from the main
+// program to the code running within a context.
+type taskKey struct{}
+
+func taskOf(ctx context.Context) []forkBranch {
+	task, _ := ctx.Value(taskKey{}).([]forkBranch)
+	return task
+}
+
+func withBranch(ctx context.Context, b forkBranch) context.Context {
+	parent := taskOf(ctx)
+	task := make([]forkBranch, len(parent), len(parent)+1)
+	copy(task, parent)
+	return context.WithValue(ctx, taskKey{}, append(task, b))
+}
+
+// vectorClock counts, for every branch, the steps of it known to have
+// happened.
+type vectorClock map[int64]int64
+
+// clock is the vector clock of a branch. A branch starts a new step whenever
+// it forks or hands something over through a channel, and learns the steps
+// of other branches from the channels it receives from and from the branches
+// it joins. Only the branch itself uses its clock.
+type clock struct {
+	id    int64
+	times vectorClock
+}
+
+type clockKey struct{}
+
+func clockOf(ctx context.Context) *clock {
+	c, _ := ctx.Value(clockKey{}).(*clock)
+	return c
+}
+
+func withClock(ctx context.Context, c *clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// snapshot copies the times of c to hand them over. The main program has no
+// clock and hands over nothing.
+func (c *clock) snapshot() vectorClock {
+	if c == nil {
+		return nil
+	}
+	return maps.Clone(c.times)
+}
+
+// tick starts a new step of c, so that what follows is not ordered before
+// the code that got an earlier snapshot.
+func (c *clock) tick() {
+	if c != nil {
+		c.times[c.id]++
+	}
+}
+
+// merge learns the steps that times knows of.
+func (c *clock) merge(times vectorClock) {
+	if c == nil {
+		return
+	}
+	for id, t := range times {
+		c.times[id] = max(c.times[id], t)
+	}
+}
+
+// concurrent reports whether code of the tasks a and b may run at the same
+// time. That happens when they run in different branches of the same fork;
+// otherwise one of them ran before the fork of the other, or after its join.
+func concurrent(a, b []forkBranch) (forkBranch, forkBranch, bool) {
+	for i := range min(len(a), len(b)) {
+		if a[i] != b[i] {
+			return a[i], b[i], a[i].fork == b[i].fork
+		}
+	}
+	return forkBranch{}, forkBranch{}, false
+}
+
+// Race is a pair of accesses to the same variable or array cell, at least
+// one of them a write, from two branches of a fork that may run at once.
+type Race struct {
+	Name         string
+	Fork         common.Position
+	FirstBranch  int
+	FirstWrite   bool
+	SecondBranch int
+	SecondWrite  bool
+}
+
+func (r Race) String() string {
+	return fmt.Sprintf("data race on '%s' in the fork at %s: %s by branch %d and %s by branch %d",
+		r.Name, r.Fork, accessKind(r.FirstWrite), r.FirstBranch, accessKind(r.SecondWrite), r.SecondBranch)
+}
+
+func accessKind(write bool) string {
+	if write {
+		return "written"
+	}
+	return "read"
+}
+
+func PrintRaces(races []Race) {
+	for _, race := range races {
+		fmt.Println(common.Colorize("WARNING: "+race.String(), common.COLOR_YELLOW))
+	}
+}
+
+// location is a variable of a scope or a cell of an array.
+type location struct {
+	holder any
+	name   string
+	index  int
+}
+
+type access struct {
+	task  []forkBranch
+	locks []string
+	write bool
+	// The access happened in the step of the branch with the clock id.
+	clock int64
+	step  int64
+}
+
+// ordered reports whether prev happened before the code running with the
+// clock c, which learnt of the step of prev through channels.
+func ordered(prev access, c *clock) bool {
+	return c.times[prev.clock] >= prev.step
+}
+
+// protected reports whether a and b hold a lock in common, which keeps them
+// from running at once.
+func protected(a, b access) bool {
+	for _, name := range a.locks {
+		if slices.Contains(b.locks, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether a holds every lock b holds.
+func covers(a, b access) bool {
+	for _, name := range b.locks {
+		if !slices.Contains(a.locks, name) {
+			return false
+		}
+	}
+	return true
+}
+
+type shadow struct {
+	accesses []access
+	raced    bool
+}
+
+// raceDetector keeps, for every location, the accesses that a later access
+// could race with. Accesses ordered before a newer one are dropped whenever
+// the newer one already races with whatever they would.
+type raceDetector struct {
+	mu      sync.Mutex
+	forks   atomic.Int64
+	clocks  atomic.Int64
+	shadows map[location]*shadow
+	races   []Race
+}
+
+func newRaceDetector() *raceDetector {
+	return &raceDetector{shadows: map[location]*shadow{}}
+}
+
+func (d *raceDetector) newFork() int64 {
+	return d.forks.Add(1)
+}
+
+// newClock returns the clock of a new branch that knows of the steps of base.
+func (d *raceDetector) newClock(base vectorClock) *clock {
+	c := &clock{id: d.clocks.Add(1), times: vectorClock{}}
+	c.merge(base)
+	c.times[c.id] = 1
+	return c
+}
+
+// record checks an access of the task running within ctx against the
+// previous accesses to the same location. Accesses holding a lock in common
+// do not race, and neither do accesses ordered by a channel. Only the first
+// race of each location is reported.
+func (d *raceDetector) record(ctx context.Context, loc location, name string, write bool) {
+	current := access{task: taskOf(ctx), locks: heldLocks(ctx), write: write}
+	if len(current.task) == 0 {
+		// Outside of forks nothing runs at the same time.
+		return
+	}
+	c := clockOf(ctx)
+	current.clock, current.step = c.id, c.times[c.id]
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.shadows[loc]
+	if !ok {
+		s = &shadow{}
+		d.shadows[loc] = s
+	}
+	if s.raced {
+		return
+	}
+
+	kept := s.accesses[:0]
+	for _, prev := range s.accesses {
+		if first, second, ok := concurrent(prev.task, current.task); ok && !ordered(prev, c) {
+			if (prev.write || write) && !protected(prev, current) {
+				d.races = append(d.races, Race{
+					Name:         name,
+					Fork:         first.position,
+					FirstBranch:  first.index,
+					FirstWrite:   prev.write,
+					SecondBranch: second.index,
+					SecondWrite:  write,
+				})
+				s.raced = true
+				s.accesses = nil
+				return
+			}
+			kept = append(kept, prev)
+			continue
+		}
+
+		// prev happened before this access. Anything racing with prev later on
+		// races with this access too, except for reads racing with a write and
+		// for accesses holding a lock this access holds but prev did not.
+		if (!write && prev.write) || !covers(prev, current) {
+			kept = append(kept, prev)
+		}
+	}
+	s.accesses = append(kept, current)
+}
+
+// joined forgets the accesses of a fork run by the main program, which are
+// ordered before anything that runs after its join.
+func (d *raceDetector) joined() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.shadows)
+}
+
+// takeRaces returns the races found so far and forgets them.
+func (d *raceDetector) takeRaces() []Race {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	races := d.races
+	d.races = nil
+	return races
+}
@@ -1,8 +1,10 @@
 package interpreter
 
 import (
+	stderrors "errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/Tinchocw/forky/common"
 	"github.com/Tinchocw/forky/common/expression"
@@ -10,6 +12,18 @@ import (
 )
 
 func resolveExpression(expr expression.Expression, env *Env) (Value, error) {
+	value, err := evaluateExpression(expr, env)
+	if err != nil {
+		// The innermost node that knows where it is locates the error.
+		if span, ok := expressionSpan(expr); ok {
+			err = errors.At(err, span)
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+func evaluateExpression(expr expression.Expression, env *Env) (Value, error) {
 	switch e := expr.(type) {
 	case *expression.LogicalOrNode:
 		return resolveLogicalOr(*e, env)
@@ -36,6 +50,33 @@ func resolveExpression(expr expression.Expression, env *Env) (Value, error) {
 	}
 }
 
+func expressionSpan(expr expression.Expression) (common.Span, bool) {
+	switch e := expr.(type) {
+	case *expression.EqualityNode:
+		return e.Operator.Span, true
+	case *expression.ComparisonNode:
+		return e.Operator.Span, true
+	case *expression.TermNode:
+		return e.Operator.Span, true
+	case *expression.FactorNode:
+		return e.Operator.Span, true
+	case *expression.UnaryNode:
+		return e.Operator.Span, true
+	case *expression.ArrayAccessNode:
+		return e.Span, true
+	case *expression.FunctionCallNode:
+		return e.Span, true
+	case *expression.TokenLiteralNode:
+		return e.Token.Span, true
+	case *expression.ForkExpressionNode:
+		return errors.PositionSpan(e.Position), true
+	case *expression.ForkReduceNode:
+		return errors.PositionSpan(e.Position), true
+	default:
+		return common.Span{}, false
+	}
+}
+
 func resolveLogicalOr(bor expression.LogicalOrNode, env *Env) (Value, error) {
 	left, err := resolveExpression(bor.Left, env)
 	if err != nil {
@@ -83,20 +124,28 @@ func resolveEquality(eq expression.EqualityNode, env *Env) (Value, error) {
 		return nil, err
 	}
 
-	if left.Type() != right.Type() {
-		return nil, fmt.Errorf("type mismatch in equality comparison: %s vs %s", left.TypeName(), right.TypeName())
-	}
+	// Any two values may be compared, as when checking whether a closed
+	// channel gave none: values of different types are just not equal.
+	equal := valuesEqual(left, right)
 
 	switch eq.Operator.Typ {
 	case common.EQUAL_EQUAL:
-		return &BoolValue{Value: left.Data() == right.Data()}, nil
+		return &BoolValue{Value: equal}, nil
 	case common.BANG_EQUAL:
-		return &BoolValue{Value: left.Data() != right.Data()}, nil
+		return &BoolValue{Value: !equal}, nil
 	default:
 		return nil, fmt.Errorf("unknown equality operator: %s", eq.Operator.Value)
 	}
 }
 
+// comparisonSymbols spells the comparison operators in errors.
+var comparisonSymbols = map[common.TokenType]string{
+	common.LESS:          "<",
+	common.LESS_EQUAL:    "<=",
+	common.GREATER:       ">",
+	common.GREATER_EQUAL: ">=",
+}
+
 func resolveComparison(cmp expression.ComparisonNode, env *Env) (Value, error) {
 	left, err := resolveExpression(cmp.Left, env)
 	if err != nil {
@@ -108,48 +157,49 @@ func resolveComparison(cmp expression.ComparisonNode, env *Env) (Value, error) {
 		return nil, err
 	}
 
-	if left.Type() != right.Type() {
-		return nil, fmt.Errorf("type mismatch in comparison: %s vs %s", left.TypeName(), right.TypeName())
+	// Floats keep their own operators, which order NaN with nothing.
+	if isFloatOperation(left, right) {
+		return compareFloats(cmp.Operator, asFloat(left), asFloat(right))
+	}
+
+	order, ordered, err := compareValues(comparisonSymbols[cmp.Operator.Typ], left, right)
+	if err != nil {
+		return nil, err
+	}
+	// Arrays told apart by NaN are ordered with nothing, as NaN is.
+	if !ordered {
+		return &BoolValue{Value: false}, nil
 	}
 
 	switch cmp.Operator.Typ {
 	case common.LESS:
-		if left.Type() == VAL_INT {
-			return &BoolValue{Value: left.(*IntValue).Value < right.(*IntValue).Value}, nil
-		}
-		if left.Type() == VAL_STRING {
-			return &BoolValue{Value: left.(*StringValue).Value < right.(*StringValue).Value}, nil
-		}
-		return nil, fmt.Errorf("operator '<' not supported for type %s", left.TypeName())
+		return &BoolValue{Value: order < 0}, nil
 	case common.LESS_EQUAL:
-		if left.Type() == VAL_INT {
-			return &BoolValue{Value: left.(*IntValue).Value <= right.(*IntValue).Value}, nil
-		}
-		if left.Type() == VAL_STRING {
-			return &BoolValue{Value: left.(*StringValue).Value <= right.(*StringValue).Value}, nil
-		}
-		return nil, fmt.Errorf("operator '<=' not supported for type %s", left.TypeName())
+		return &BoolValue{Value: order <= 0}, nil
 	case common.GREATER:
-		if left.Type() == VAL_INT {
-			return &BoolValue{Value: left.(*IntValue).Value > right.(*IntValue).Value}, nil
-		}
-		if left.Type() == VAL_STRING {
-			return &BoolValue{Value: left.(*StringValue).Value > right.(*StringValue).Value}, nil
-		}
-		return nil, fmt.Errorf("operator '>' not supported for type %s", left.TypeName())
+		return &BoolValue{Value: order > 0}, nil
 	case common.GREATER_EQUAL:
-		if left.Type() == VAL_INT {
-			return &BoolValue{Value: left.(*IntValue).Value >= right.(*IntValue).Value}, nil
-		}
-		if left.Type() == VAL_STRING {
-			return &BoolValue{Value: left.(*StringValue).Value >= right.(*StringValue).Value}, nil
-		}
-		return nil, fmt.Errorf("operator '>=' not supported for type %s", left.TypeName())
+		return &BoolValue{Value: order >= 0}, nil
 	default:
 		return nil, fmt.Errorf("unknown comparison operator: %s", cmp.Operator.Value)
 	}
 }
 
+func compareFloats(operator common.Token, left, right float64) (Value, error) {
+	switch operator.Typ {
+	case common.LESS:
+		return &BoolValue{Value: left < right}, nil
+	case common.LESS_EQUAL:
+		return &BoolValue{Value: left <= right}, nil
+	case common.GREATER:
+		return &BoolValue{Value: left > right}, nil
+	case common.GREATER_EQUAL:
+		return &BoolValue{Value: left >= right}, nil
+	default:
+		return nil, fmt.Errorf("unknown comparison operator: %s", operator.Value)
+	}
+}
+
 func resolveTerm(term expression.TermNode, env *Env) (Value, error) {
 	left, err := resolveExpression(term.Left, env)
 	if err != nil {
@@ -163,6 +213,10 @@ func resolveTerm(term expression.TermNode, env *Env) (Value, error) {
 
 	switch term.Operator.Typ {
 	case common.PLUS:
+		if isFloatOperation(left, right) {
+			return &FloatValue{Value: asFloat(left) + asFloat(right)}, nil
+		}
+
 		if left.Type() != right.Type() {
 			return &StringValue{Value: left.Content() + right.Content()}, nil
 		}
@@ -175,12 +229,15 @@ func resolveTerm(term expression.TermNode, env *Env) (Value, error) {
 			return &StringValue{Value: left.Data().(string) + right.Data().(string)}, nil
 		}
 
-		return nil, fmt.Errorf("operator '+' not supported for type %s and type %s", left.TypeName(), right.TypeName())
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "operator '+' not supported for type %s and type %s", left.TypeName(), right.TypeName())
 	case common.MINUS:
 		if left.Type() == VAL_INT && right.Type() == VAL_INT {
 			return &IntValue{Value: left.Data().(int) - right.Data().(int)}, nil
 		}
-		return nil, fmt.Errorf("operator '-' not supported for type %s and type %s", left.TypeName(), right.TypeName())
+		if isFloatOperation(left, right) {
+			return &FloatValue{Value: asFloat(left) - asFloat(right)}, nil
+		}
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "operator '-' not supported for type %s and type %s", left.TypeName(), right.TypeName())
 	default:
 		return nil, fmt.Errorf("unknown term operator: %s", term.Operator.Value)
 	}
@@ -197,8 +254,12 @@ func resolveFactor(factor expression.FactorNode, env *Env) (Value, error) {
 		return nil, err
 	}
 
+	if isFloatOperation(left, right) {
+		return resolveFloatFactor(factor.Operator, asFloat(left), asFloat(right))
+	}
+
 	if left.Type() != right.Type() {
-		return nil, fmt.Errorf("type mismatch in factor operation: %s vs %s", left.TypeName(), right.TypeName())
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "type mismatch in factor operation: %s vs %s", left.TypeName(), right.TypeName())
 	}
 
 	switch factor.Operator.Typ {
@@ -206,20 +267,34 @@ func resolveFactor(factor expression.FactorNode, env *Env) (Value, error) {
 		if left.Type() == VAL_INT {
 			return &IntValue{Value: left.Data().(int) * right.Data().(int)}, nil
 		}
-		return nil, fmt.Errorf("operator '*' not supported for type %s", left.TypeName())
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "operator '*' not supported for type %s", left.TypeName())
 	case common.SLASH:
 		if left.Type() == VAL_INT {
 			if right.Data().(int) == 0 {
-				return nil, fmt.Errorf("division by zero")
+				return nil, errors.NewRuntimeError(errors.ARITHMETIC_ERROR, "division by zero")
 			}
 			return &IntValue{Value: left.Data().(int) / right.Data().(int)}, nil
 		}
-		return nil, fmt.Errorf("operator '/' not supported for type %s", left.TypeName())
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "operator '/' not supported for type %s", left.TypeName())
 	default:
 		return nil, fmt.Errorf("unknown factor operator: %s", factor.Operator.Value)
 	}
 }
 
+func resolveFloatFactor(operator common.Token, left, right float64) (Value, error) {
+	switch operator.Typ {
+	case common.ASTERISK:
+		return &FloatValue{Value: left * right}, nil
+	case common.SLASH:
+		if right == 0 {
+			return nil, errors.NewRuntimeError(errors.ARITHMETIC_ERROR, "division by zero")
+		}
+		return &FloatValue{Value: left / right}, nil
+	default:
+		return nil, fmt.Errorf("unknown factor operator: %s", operator.Value)
+	}
+}
+
 func resolveUnary(unary expression.UnaryNode, env *Env) (Value, error) {
 	right, err := resolveExpression(unary.Right, env)
 	if err != nil {
@@ -231,12 +306,18 @@ func resolveUnary(unary expression.UnaryNode, env *Env) (Value, error) {
 		if right.Type() == VAL_INT {
 			return &IntValue{Value: right.Data().(int)}, nil
 		}
-		return nil, fmt.Errorf("unary '+' not supported for type %s", right.TypeName())
+		if right.Type() == VAL_FLOAT {
+			return &FloatValue{Value: right.Data().(float64)}, nil
+		}
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "unary '+' not supported for type %s", right.TypeName())
 	case common.MINUS:
 		if right.Type() == VAL_INT {
 			return &IntValue{Value: -right.Data().(int)}, nil
 		}
-		return nil, fmt.Errorf("unary '-' not supported for type %s", right.TypeName())
+		if right.Type() == VAL_FLOAT {
+			return &FloatValue{Value: -right.Data().(float64)}, nil
+		}
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "unary '-' not supported for type %s", right.TypeName())
 	case common.BANG:
 		return &BoolValue{Value: !right.IsTruthy()}, nil
 	default:
@@ -245,33 +326,55 @@ func resolveUnary(unary expression.UnaryNode, env *Env) (Value, error) {
 }
 
 func resolveArrayAccess(aa expression.ArrayAccessNode, env *Env) (Value, error) {
-	left, err := resolveExpression(aa.Left, env)
+	value, _, err := resolveArrayCell(aa, env)
+	return value, err
+}
+
+// resolveArrayCell also returns how the accessed cell is named, as grid[1][2],
+// when the race detector needs it.
+func resolveArrayCell(aa expression.ArrayAccessNode, env *Env) (Value, string, error) {
+	var left Value
+	var name string
+	var err error
+
+	if inner, ok := aa.Left.(*expression.ArrayAccessNode); ok {
+		left, name, err = resolveArrayCell(*inner, env)
+	} else {
+		left, err = resolveExpression(aa.Left, env)
+		name = "array"
+		if literal, ok := aa.Left.(*expression.TokenLiteralNode); ok {
+			name = literal.Token.Value
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if left.Type() != VAL_ARRAY {
-		return nil, fmt.Errorf("attempted to index a non-array value")
+		return nil, "", errors.NewRuntimeError(errors.TYPE_ERROR, "attempted to index a non-array value")
 	}
 
 	indexValue, err := resolveExpression(aa.Index, env)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if indexValue.Type() != VAL_INT {
-		return nil, fmt.Errorf("array index must be an integer")
+		return nil, "", errors.NewRuntimeError(errors.TYPE_ERROR, "array index must be an integer")
 	}
 
 	index := indexValue.(*IntValue).Value
 	av := left.(*ArrayValue)
-
-	if index < 0 || index >= len(av.Values) {
-		return nil, fmt.Errorf("array index %d out of bounds", index)
+	value, err := av.Get(index)
+	if err != nil {
+		return nil, "", err
 	}
 
-	val := av.Values[index]
-	return val, nil
+	if env.races != nil {
+		name = fmt.Sprintf("%s[%d]", name, index)
+		env.recordAccess(location{holder: av, index: index}, name, false)
+	}
+	return value, name, nil
 }
 
 func resolveFunctionCall(fc expression.FunctionCallNode, env *Env) (Value, error) {
@@ -281,13 +384,13 @@ func resolveFunctionCall(fc expression.FunctionCallNode, env *Env) (Value, error
 	}
 
 	if callee.Type() != VAL_FUNCTION {
-		return nil, fmt.Errorf("attempted to call a non-function value")
+		return nil, errors.NewRuntimeError(errors.CALL_ERROR, "attempted to call a non-function value")
 	}
 
 	function := callee.(*FunctionValue).Function
 
 	if len(fc.Arguments) != len(function.Parameters) {
-		return nil, fmt.Errorf("expected %d arguments, got %d", len(function.Parameters), len(fc.Arguments))
+		return nil, errors.NewRuntimeError(errors.CALL_ERROR, "expected %d arguments, got %d", len(function.Parameters), len(fc.Arguments))
 	}
 
 	args := make([]Value, 0, len(fc.Arguments))
@@ -299,10 +402,10 @@ func resolveFunctionCall(fc expression.FunctionCallNode, env *Env) (Value, error
 		args = append(args, argValue)
 	}
 
-	value, err := function.Call(args, env)
+	value, err := function.Call(env.ctx, args)
 
 	if err == nil || !errors.IsReturnErr(err) {
-		return nil, err
+		return nil, errors.WithFrame(err, errors.Frame{Function: function.Name, Site: fc.Span})
 	}
 
 	return value, nil
@@ -319,18 +422,44 @@ func resolvePrimary(primary expression.Primary, env *Env) (Value, error) {
 	case *expression.ArrayLiteralNode:
 		return resolveArrayLiteral(*p, env)
 
+	case *expression.FunctionLiteralNode:
+		return resolveFunctionLiteral(*p, env)
+
+	case *expression.ForkExpressionNode:
+		return resolveForkExpression(*p, env)
+
+	case *expression.ForkReduceNode:
+		return resolveForkReduce(*p, env)
+
 	default:
 		return nil, fmt.Errorf("unknown primary type")
 	}
 }
 
+// numberError reports a number literal that strconv could not parse, telling
+// the ones too large to represent from malformed ones.
+func numberError(literal string, err error) error {
+	if stderrors.Is(err, strconv.ErrRange) {
+		return errors.NewRuntimeError(errors.VALUE_ERROR, "number out of range: %s", literal)
+	}
+	return errors.NewRuntimeError(errors.VALUE_ERROR, "invalid number: %s", literal)
+}
+
 func resolveTokenLiteral(tl expression.TokenLiteralNode, env *Env) (Value, error) {
 	token := tl.Token
 	switch token.Typ {
 	case common.NUMBER:
+		if strings.ContainsAny(token.Value, ".eE") {
+			num, err := strconv.ParseFloat(token.Value, 64)
+			if err != nil {
+				return nil, numberError(token.Value, err)
+			}
+			return &FloatValue{Value: num}, nil
+		}
+
 		num, err := strconv.Atoi(token.Value)
 		if err != nil {
-			return nil, fmt.Errorf("invalid number: %s", token.Value)
+			return nil, numberError(token.Value, err)
 		}
 		return &IntValue{Value: num}, nil
 	case common.LITERAL:
@@ -342,17 +471,16 @@ func resolveTokenLiteral(tl expression.TokenLiteralNode, env *Env) (Value, error
 	case common.NONE:
 		return &NoneValue{}, nil
 	case common.IDENTIFIER:
-		value, err := env.GetVariable(token.Value)
-		if err != nil {
-			return nil, err
-		}
-		return value, nil
+		return env.GetVariable(token.Value)
 	default:
 		return nil, fmt.Errorf("unknown literal type: %v", token.Typ)
 	}
 }
 
 func resolveArrayLiteral(al expression.ArrayLiteralNode, env *Env) (Value, error) {
+	if err := env.memory.allocate(len(al.Elements)); err != nil {
+		return nil, err
+	}
 	elements := make([]Value, len(al.Elements))
 
 	for i, elemExpr := range al.Elements {
@@ -366,3 +494,51 @@ func resolveArrayLiteral(al expression.ArrayLiteralNode, env *Env) (Value, error
 	return &ArrayValue{Values: elements}, nil
 
 }
+
+func resolveFunctionLiteral(fl expression.FunctionLiteralNode, env *Env) (Value, error) {
+	return &FunctionValue{Function: NewFunction(anonymousFunction, fl.Parameters, fl.Body.Statements, env)}, nil
+}
+
+func resolveForkExpression(fe expression.ForkExpressionNode, env *Env) (Value, error) {
+	results, err := forkArray(env, "fork expression", fe.Position, fe.Array, fe.IndexName, fe.ElemName, fe.Body, true)
+	if err != nil {
+		return nil, err
+	}
+	return &ArrayValue{Values: results}, nil
+}
+
+func resolveForkReduce(fr expression.ForkReduceNode, env *Env) (Value, error) {
+	value, err := resolveExpression(fr.Array, env)
+	if err != nil {
+		return nil, err
+	}
+	if value.Type() != VAL_ARRAY {
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "expected array type in fork reduce, got %s", value.TypeName())
+	}
+
+	identity, err := resolveExpression(fr.Identity, env)
+	if err != nil {
+		return nil, err
+	}
+
+	combine, err := resolveExpression(fr.Combine, env)
+	if err != nil {
+		return nil, err
+	}
+	if combine.Type() != VAL_FUNCTION {
+		return nil, errors.NewRuntimeError(errors.TYPE_ERROR, "expected a combining function in fork reduce, got %s", combine.TypeName())
+	}
+	function := combine.(*FunctionValue).Function
+	if len(function.Parameters) != 2 {
+		return nil, errors.NewRuntimeError(errors.CALL_ERROR, "the combining function of fork reduce must take 2 arguments, it takes %d", len(function.Parameters))
+	}
+
+	// With a bound on the workers, halves smaller than what gives each of them
+	// a few only add forks.
+	elements := value.(*ArrayValue).Elements()
+	grain := reduceGrain
+	if workers := env.scheduler.workers; workers > 0 {
+		grain = max(grain, len(elements)/(workers*chunksPerWorker))
+	}
+	return forkReduce(env, fr.Position, elements, identity, function, grain)
+}
@@ -0,0 +1,83 @@
+package interpreter
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// chunksPerWorker splits the branches of a fork in more chunks than workers,
+// so a worker that finishes early takes over the pending ones.
+const chunksPerWorker = 4
+
+// scheduler runs the branches of forks. Without a bound every branch gets a
+// goroutine of its own; otherwise at most workers goroutines run at once, and
+// run branches in chunks of consecutive ones. Blocked goroutines do not count,
+// so branches waiting for one another always get to run.
+type scheduler struct {
+	workers int
+}
+
+func newScheduler(workers int) *scheduler {
+	return &scheduler{workers: max(workers, 0)}
+}
+
+// run calls branch for every index in [0, count) and returns once all of them
+// have returned. The calling goroutine runs chunks too, so when every worker
+// is busy, as with nested forks, a fork never waits for a free one. The
+// goroutines are started and joined through m, which tells the join apart, as
+// reason, from other ways the branch running ctx can be blocked.
+func (s *scheduler) run(ctx context.Context, m *monitor, reason string, count int, branch func(index int)) {
+	g := &group{}
+
+	if s.workers == 0 {
+		for index := range count {
+			m.spawn(g, func() {
+				branch(index)
+			})
+		}
+		m.join(ctx, g, reason)
+		return
+	}
+
+	chunks := min(count, s.workers*chunksPerWorker)
+	if chunks == 0 {
+		return
+	}
+	size := (count + chunks - 1) / chunks
+	t := &task{group: g, branch: branch, count: count, size: size, chunks: (count + size - 1) / size, workers: s.workers}
+
+	m.offer(t)
+	if chunk, ok := t.take(); ok {
+		t.work(chunk)
+	}
+	m.withdraw(t)
+	m.join(ctx, g, reason)
+}
+
+// task is a fork whose branches run in chunks. The goroutine forking takes
+// chunks until none is left, and so does every goroutine the monitor starts
+// for the task while fewer than workers are running.
+type task struct {
+	group   *group
+	branch  func(index int)
+	count   int
+	size    int
+	chunks  int
+	workers int
+	next    atomic.Int64
+}
+
+// take claims the next chunk nobody runs yet, if there is one.
+func (t *task) take() (int, bool) {
+	chunk := int(t.next.Add(1)) - 1
+	return chunk, chunk < t.chunks
+}
+
+// work runs chunk, then every other chunk it can take.
+func (t *task) work(chunk int) {
+	for ok := true; ok; chunk, ok = t.take() {
+		for index := chunk * t.size; index < min((chunk+1)*t.size, t.count); index++ {
+			t.branch(index)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package interpreter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestMonitor returns a monitor that began an execution, and the context
+// of that execution, cancelled when it deadlocks.
+func newTestMonitor(t *testing.T) (*monitor, context.Context) {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	t.Cleanup(func() { cancel(nil) })
+
+	m := newMonitor(nil)
+	m.begin(cancel)
+	t.Cleanup(m.end)
+	return m, ctx
+}
+
+// concurrency tracks how many branches run at once.
+type concurrency struct {
+	running atomic.Int64
+	most    atomic.Int64
+}
+
+func (c *concurrency) enter() {
+	running := c.running.Add(1)
+	for most := c.most.Load(); running > most && !c.most.CompareAndSwap(most, running); most = c.most.Load() {
+	}
+}
+
+func (c *concurrency) exit() {
+	c.running.Add(-1)
+}
+
+func TestSchedulerChunks(t *testing.T) {
+	tests := []struct {
+		workers int
+		count   int
+	}{
+		{0, 10},
+		{1, 0},
+		{1, 1},
+		{1, 100},
+		{2, 3},
+		{2, 100},
+		{3, 1000},
+	}
+
+	for _, test := range tests {
+		m, ctx := newTestMonitor(t)
+		s := newScheduler(test.workers)
+
+		var (
+			mu   sync.Mutex
+			runs = make([]int, test.count)
+			c    concurrency
+		)
+		s.run(context.Background(), m, "test", test.count, func(index int) {
+			c.enter()
+			defer c.exit()
+			mu.Lock()
+			runs[index]++
+			mu.Unlock()
+		})
+
+		for index, n := range runs {
+			if n != 1 {
+				t.Errorf("%d workers, %d branches: branch %d ran %d times", test.workers, test.count, index, n)
+			}
+		}
+		if test.workers > 0 && c.most.Load() > int64(test.workers) {
+			t.Errorf("%d workers, %d branches: %d branches ran at once", test.workers, test.count, c.most.Load())
+		}
+		if err := context.Cause(ctx); err != nil {
+			t.Errorf("%d workers, %d branches: cancelled with %v", test.workers, test.count, err)
+		}
+	}
+}
+
+func TestSchedulerChunkSizes(t *testing.T) {
+	tests := []struct {
+		workers int
+		count   int
+		size    int
+		chunks  int
+	}{
+		{1, 3, 1, 3},
+		{1, 100, 25, 4},
+		{2, 100, 13, 8},
+		{4, 10, 1, 10},
+		{4, 1000, 63, 16},
+	}
+
+	for _, test := range tests {
+		m, _ := newTestMonitor(t)
+		s := newScheduler(test.workers)
+
+		// Branches of the same chunk run one after the other, in order.
+		var (
+			mu     sync.Mutex
+			starts = map[int]bool{}
+			last   = map[int]int{}
+		)
+		s.run(context.Background(), m, "test", test.count, func(index int) {
+			mu.Lock()
+			defer mu.Unlock()
+			chunk := index / test.size
+			if index%test.size == 0 {
+				starts[chunk] = true
+			} else if last[chunk] != index-1 {
+				t.Errorf("%d workers, %d branches: branch %d ran after %d", test.workers, test.count, index, last[chunk])
+			}
+			last[chunk] = index
+		})
+
+		if len(starts) != test.chunks {
+			t.Errorf("%d workers, %d branches: got %d chunks, want %d", test.workers, test.count, len(starts), test.chunks)
+		}
+	}
+}
+
+func TestSchedulerNestedForks(t *testing.T) {
+	for _, workers := range []int{1, 2} {
+		m, ctx := newTestMonitor(t)
+		s := newScheduler(workers)
+
+		// Every worker is busy with an outer branch when the inner forks start,
+		// so the outer branches run the inner ones themselves.
+		var (
+			inner atomic.Int64
+			c     concurrency
+		)
+		s.run(context.Background(), m, "outer", 8, func(int) {
+			s.run(context.Background(), m, "inner", 8, func(int) {
+				c.enter()
+				defer c.exit()
+				inner.Add(1)
+			})
+		})
+
+		if inner.Load() != 64 {
+			t.Errorf("%d workers: got %d inner branches, want 64", workers, inner.Load())
+		}
+		if c.most.Load() > int64(workers) {
+			t.Errorf("%d workers: %d branches ran at once", workers, c.most.Load())
+		}
+		if err := context.Cause(ctx); err != nil {
+			t.Errorf("%d workers: cancelled with %v", workers, err)
+		}
+	}
+}
+
+func TestSchedulerBlockedBranches(t *testing.T) {
+	m, ctx := newTestMonitor(t)
+	s := newScheduler(1)
+
+	// Each branch waits for the next one, which has not started when it
+	// blocks: only a worker taken over while it waits lets that one run.
+	const count = 4
+	done := make([]bool, count)
+	s.run(context.Background(), m, "test", count, func(index int) {
+		if index+1 < count {
+			if err := m.block(context.Background(), "waiting", nil, func() bool { return done[index+1] }); err != nil {
+				t.Errorf("branch %d: %v", index, err)
+			}
+		}
+		m.block(context.Background(), "done", nil, func() bool {
+			done[index] = true
+			return true
+		})
+	})
+
+	for index, ok := range done {
+		if !ok {
+			t.Errorf("branch %d did not finish", index)
+		}
+	}
+	if err := context.Cause(ctx); err != nil {
+		t.Errorf("cancelled with %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package interpreter
+
+import (
+	"math/rand"
+)
+
+// thread is a goroutine of an execution that only runs while it has the turn.
+type thread struct {
+	turn chan struct{}
+	// index is where the thread is among the runnable ones.
+	index int
+}
+
+func newThread() *thread {
+	return &thread{turn: make(chan struct{}, 1)}
+}
+
+// await waits until t has the turn. Without turns, t is nil and every
+// goroutine runs whenever it can.
+func (t *thread) await() {
+	if t != nil {
+		<-t.turn
+	}
+}
+
+// turns lets one goroutine of an execution run at a time. At every statement
+// boundary it picks the next one among those that can run, from a source
+// seeded by seed, so executions with the same seed interleave their branches
+// the same way. It is guarded by the mutex of the monitor using it.
+type turns struct {
+	seed     int64
+	rand     *rand.Rand
+	runnable []*thread
+	current  *thread
+}
+
+func newTurns(seed int64) *turns {
+	return &turns{seed: seed}
+}
+
+// reset starts over for an execution run by the calling goroutine, which has
+// the turn.
+func (t *turns) reset() {
+	if t == nil {
+		return
+	}
+	t.rand = rand.New(rand.NewSource(t.seed))
+	t.current = newThread()
+	t.runnable = []*thread{t.current}
+	t.current.index = 0
+}
+
+// spawn adds a thread for a new goroutine, which can run once it gets the turn.
+func (t *turns) spawn() *thread {
+	if t == nil {
+		return nil
+	}
+	th := newThread()
+	t.ready(th)
+	return th
+}
+
+// ready lets th run again. It gets the turn right away if nobody has it.
+func (t *turns) ready(th *thread) {
+	if t == nil {
+		return
+	}
+	th.index = len(t.runnable)
+	t.runnable = append(t.runnable, th)
+	if t.current == nil {
+		t.give(th)
+	}
+}
+
+// suspend takes the current thread out of the runnable ones, as it blocks or
+// exits, and gives the turn to another. It returns the suspended thread.
+func (t *turns) suspend() *thread {
+	if t == nil {
+		return nil
+	}
+	th := t.current
+	// The last runnable thread takes its place: the order changes, but the
+	// same way every time.
+	last := t.runnable[len(t.runnable)-1]
+	t.runnable[th.index] = last
+	last.index = th.index
+	t.runnable = t.runnable[:len(t.runnable)-1]
+	t.current = nil
+	if len(t.runnable) > 0 {
+		t.give(t.pick())
+	}
+	return th
+}
+
+// yield picks the thread that runs next. It returns the current thread when
+// it has to await its turn again, or nil when it keeps it.
+func (t *turns) yield() *thread {
+	if t == nil || len(t.runnable) < 2 {
+		return nil
+	}
+	th, next := t.current, t.pick()
+	if next == th {
+		return nil
+	}
+	t.give(next)
+	return th
+}
+
+func (t *turns) pick() *thread {
+	return t.runnable[t.rand.Intn(len(t.runnable))]
+}
+
+func (t *turns) give(th *thread) {
+	t.current = th
+	th.turn <- struct{}{}
+}
@@ -9,6 +9,8 @@ const (
 	VAL_NONE
 	VAL_ARRAY
 	VAL_FUNCTION
+	VAL_FLOAT
+	VAL_CHANNEL
 )
 
 type Value interface {
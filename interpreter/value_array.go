@@ -1,14 +1,25 @@
 package interpreter
 
+import (
+	"sync"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// ArrayValue is shared by every variable and fork branch that refers to it,
+// so its elements are only read and written while holding mu once built.
 type ArrayValue struct {
 	Values []Value
+	mu     sync.RWMutex
 }
 
-func (av ArrayValue) Content() string {
+func (av *ArrayValue) Content() string {
+	elements := av.Elements()
+
 	str := "["
-	for i, val := range av.Values {
+	for i, val := range elements {
 		str += val.Content()
-		if i < len(av.Values)-1 {
+		if i < len(elements)-1 {
 			str += ", "
 		}
 	}
@@ -16,18 +27,50 @@ func (av ArrayValue) Content() string {
 	return str
 }
 
-func (av ArrayValue) IsTruthy() bool {
-	return len(av.Values) > 0
+func (av *ArrayValue) IsTruthy() bool {
+	return av.Len() > 0
 }
 
-func (av ArrayValue) Type() ValueType {
+func (av *ArrayValue) Type() ValueType {
 	return VAL_ARRAY
 }
 
-func (av ArrayValue) Data() any {
-	return av.Values
+func (av *ArrayValue) Data() any {
+	return av.Elements()
 }
 
-func (av ArrayValue) TypeName() string {
+func (av *ArrayValue) TypeName() string {
 	return "ARRAY"
 }
+
+func (av *ArrayValue) Len() int {
+	av.mu.RLock()
+	defer av.mu.RUnlock()
+	return len(av.Values)
+}
+
+// Elements returns a snapshot of the elements of the array.
+func (av *ArrayValue) Elements() []Value {
+	av.mu.RLock()
+	defer av.mu.RUnlock()
+	return append([]Value(nil), av.Values...)
+}
+
+func (av *ArrayValue) Get(index int) (Value, error) {
+	av.mu.RLock()
+	defer av.mu.RUnlock()
+	if index < 0 || index >= len(av.Values) {
+		return nil, errors.NewRuntimeError(errors.INDEX_ERROR, "array index %d out of bounds", index)
+	}
+	return av.Values[index], nil
+}
+
+func (av *ArrayValue) Set(index int, val Value) error {
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	if index < 0 || index >= len(av.Values) {
+		return errors.NewRuntimeError(errors.INDEX_ERROR, "array index %d out of bounds", index)
+	}
+	av.Values[index] = val
+	return nil
+}
@@ -0,0 +1,162 @@
+package interpreter
+
+import (
+	"context"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// ChannelValue passes values between branches, first in first out. Its
+// state is guarded by the monitor of the execution using it: sends and
+// receives that cannot go on wait there.
+type ChannelValue struct {
+	capacity int
+	buffer   []message
+	closed   bool
+	// closedBy is the clock of the branch that closed the channel, when
+	// races are detected.
+	closedBy vectorClock
+	// receivers are the goroutines blocked to receive from the channel,
+	// oldest first.
+	receivers []*ticket
+}
+
+// ticket is a goroutine blocked to receive from any of channels. A sender
+// that finds no room in the buffer hands its value over by filling the
+// ticket of a receiver, which only a single sender can do: one that waits in
+// a select on several channels takes a single value.
+type ticket struct {
+	channels []*ChannelValue
+	filled   bool
+	message  message
+	// from is the channel whose sender filled the ticket.
+	from *ChannelValue
+}
+
+// message is a value sent to a channel. It carries the clock of its sender
+// when races are detected, so that what the sender did before the send is
+// ordered before what the receiver does after it.
+type message struct {
+	value Value
+	clock vectorClock
+}
+
+func newTicket(channels []*ChannelValue) *ticket {
+	return &ticket{channels: channels}
+}
+
+func NewChannelValue(capacity int) *ChannelValue {
+	return &ChannelValue{capacity: capacity}
+}
+
+func (cv *ChannelValue) Content() string {
+	return "<channel>"
+}
+
+func (cv *ChannelValue) IsTruthy() bool {
+	return true
+}
+
+func (cv *ChannelValue) Type() ValueType {
+	return VAL_CHANNEL
+}
+
+func (cv *ChannelValue) Data() any {
+	return cv
+}
+
+func (cv *ChannelValue) TypeName() string {
+	return "CHANNEL"
+}
+
+// trySend hands msg to the oldest receiver waiting for it, or else puts it
+// in a free slot of the buffer. A receiver waiting with own, as a select
+// sending to the channel too, does not count. It fails on closed channels.
+func (cv *ChannelValue) trySend(msg message, own *ticket) (bool, error) {
+	if cv.closed {
+		return true, errors.NewRuntimeError(errors.CHANNEL_ERROR, "send on a closed channel")
+	}
+	if len(cv.buffer) == 0 {
+		for _, t := range cv.receivers {
+			if t != own && !t.filled {
+				t.filled = true
+				t.message = msg
+				t.from = cv
+				return true, nil
+			}
+		}
+	}
+	if len(cv.buffer) >= cv.capacity {
+		return false, nil
+	}
+	cv.buffer = append(cv.buffer, msg)
+	return true, nil
+}
+
+// tryReceive takes the oldest message of the channel. Once a channel is
+// closed and empty, receiving gives none right away, along with the clock of
+// the branch that closed it.
+func (cv *ChannelValue) tryReceive() (message, bool) {
+	if len(cv.buffer) > 0 {
+		msg := cv.buffer[0]
+		cv.buffer = cv.buffer[1:]
+		return msg, true
+	}
+	if cv.closed {
+		return message{value: &NoneValue{}, clock: cv.closedBy}, true
+	}
+	return message{}, false
+}
+
+func (cv *ChannelValue) send(ctx context.Context, m *monitor, value Value) error {
+	c := clockOf(ctx)
+	msg := message{value: value, clock: c.snapshot()}
+	var err error
+	blockErr := m.block(ctx, "sending to a channel", nil, func() bool {
+		var sent bool
+		sent, err = cv.trySend(msg, nil)
+		return sent
+	})
+	if blockErr != nil {
+		return blockErr
+	}
+	if err == nil {
+		c.tick()
+	}
+	return err
+}
+
+func (cv *ChannelValue) receive(ctx context.Context, m *monitor) (Value, error) {
+	var msg message
+	t := newTicket([]*ChannelValue{cv})
+	err := m.block(ctx, "receiving from a channel", t, func() bool {
+		if t.filled {
+			msg = t.message
+			return true
+		}
+		var received bool
+		msg, received = cv.tryReceive()
+		return received
+	})
+	if err != nil {
+		return nil, err
+	}
+	clockOf(ctx).merge(msg.clock)
+	return msg.value, nil
+}
+
+func (cv *ChannelValue) close(ctx context.Context, m *monitor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cv.closed {
+		return errors.NewRuntimeError(errors.CHANNEL_ERROR, "close of a closed channel")
+	}
+	cv.closed = true
+	c := clockOf(ctx)
+	cv.closedBy = c.snapshot()
+	c.tick()
+	// Blocked receivers get none and blocked senders fail.
+	m.wake()
+	return nil
+}
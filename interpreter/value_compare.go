@@ -0,0 +1,133 @@
+package interpreter
+
+import (
+	"cmp"
+	"math"
+
+	"github.com/Tinchocw/forky/interpreter/errors"
+)
+
+// comparison compares two values, element by element when they are arrays.
+// Arrays may hold themselves, so a pair of arrays met again while comparing
+// them is taken as equal: nothing inside tells them apart.
+type comparison struct {
+	// operator is what the comparison is for, to tell in errors.
+	operator string
+	seen     map[[2]*ArrayValue]struct{}
+}
+
+// valuesEqual reports whether left and right are equal. Numbers are equal
+// when their values are, ints and floats alike. Arrays are equal when they
+// have the same length and equal elements, so one holding NaN is not even
+// equal to itself. Functions and channels are only equal to themselves.
+// Values of any other two types are never equal.
+func valuesEqual(left, right Value) bool {
+	return (&comparison{}).equal(left, right)
+}
+
+// compareValues orders left and right, as cmp.Compare does, for operator.
+// Numbers are ordered by value, and strings and arrays lexicographically.
+// Other values have no order, but arrays may still hold them: equal ones
+// leave the order to the next elements. It tells with ordered whether there
+// is an order at all: arrays whose first elements to differ involve NaN have
+// none, as floats do.
+func compareValues(operator string, left, right Value) (order int, ordered bool, err error) {
+	return (&comparison{operator: operator}).compare(left, right)
+}
+
+func (c *comparison) equal(left, right Value) bool {
+	if isFloatOperation(left, right) {
+		return asFloat(left) == asFloat(right)
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left.Type() {
+	case VAL_ARRAY:
+		leftElements, rightElements, done := c.elements(left, right)
+		if done {
+			return true
+		}
+		if len(leftElements) != len(rightElements) {
+			return false
+		}
+		for i := range leftElements {
+			if !c.equal(leftElements[i], rightElements[i]) {
+				return false
+			}
+		}
+		return true
+	case VAL_FUNCTION, VAL_CHANNEL:
+		return left == right
+	case VAL_NONE:
+		return true
+	default:
+		return left.Data() == right.Data()
+	}
+}
+
+func (c *comparison) compare(left, right Value) (int, bool, error) {
+	if isFloatOperation(left, right) {
+		leftFloat, rightFloat := asFloat(left), asFloat(right)
+		if math.IsNaN(leftFloat) || math.IsNaN(rightFloat) {
+			return 0, false, nil
+		}
+		return cmp.Compare(leftFloat, rightFloat), true, nil
+	}
+	if left.Type() != right.Type() {
+		return 0, false, errors.NewRuntimeError(errors.TYPE_ERROR, "type mismatch in comparison: %s vs %s", left.TypeName(), right.TypeName())
+	}
+
+	switch left.Type() {
+	case VAL_INT:
+		return cmp.Compare(left.(*IntValue).Value, right.(*IntValue).Value), true, nil
+	case VAL_STRING:
+		return cmp.Compare(left.(*StringValue).Value, right.(*StringValue).Value), true, nil
+	case VAL_ARRAY:
+		leftElements, rightElements, done := c.elements(left, right)
+		if done {
+			return 0, true, nil
+		}
+		for i := range min(len(leftElements), len(rightElements)) {
+			if order, ordered, err := c.compareElements(leftElements[i], rightElements[i]); err != nil || !ordered || order != 0 {
+				return order, ordered, err
+			}
+		}
+		// One is a prefix of the other: the shorter comes first.
+		return cmp.Compare(len(leftElements), len(rightElements)), true, nil
+	default:
+		return 0, false, errors.NewRuntimeError(errors.TYPE_ERROR, "operator '%s' not supported for type %s", c.operator, left.TypeName())
+	}
+}
+
+// compareElements orders two elements of the arrays being compared. Those of
+// a type with no order are only told apart when they differ.
+func (c *comparison) compareElements(left, right Value) (int, bool, error) {
+	if left.Type() == right.Type() {
+		switch left.Type() {
+		case VAL_BOOL, VAL_NONE, VAL_FUNCTION, VAL_CHANNEL:
+			if c.equal(left, right) {
+				return 0, true, nil
+			}
+		}
+	}
+	return c.compare(left, right)
+}
+
+// elements returns the elements of the arrays left and right to compare, or
+// done when they are being compared already, as arrays holding themselves
+// are. The same array is compared with itself all the same, since it may
+// hold NaN.
+func (c *comparison) elements(left, right Value) (leftElements, rightElements []Value, done bool) {
+	l, r := left.(*ArrayValue), right.(*ArrayValue)
+	pair := [2]*ArrayValue{l, r}
+	if _, ok := c.seen[pair]; ok {
+		return nil, nil, true
+	}
+	if c.seen == nil {
+		c.seen = map[[2]*ArrayValue]struct{}{}
+	}
+	c.seen[pair] = struct{}{}
+	return l.Elements(), r.Elements(), false
+}
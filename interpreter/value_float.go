@@ -0,0 +1,52 @@
+package interpreter
+
+import (
+	"strconv"
+	"strings"
+)
+
+type FloatValue struct {
+	Value float64
+}
+
+func (fv FloatValue) Content() string {
+	str := strconv.FormatFloat(fv.Value, 'g', -1, 64)
+	// Keep floats recognizable when they hold a whole number: 2.0, not 2.
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
+func (fv FloatValue) IsTruthy() bool {
+	return fv.Value != 0
+}
+
+func (fv FloatValue) Type() ValueType {
+	return VAL_FLOAT
+}
+
+func (fv FloatValue) Data() any {
+	return fv.Value
+}
+
+func (fv FloatValue) TypeName() string {
+	return "FLOAT"
+}
+
+func isNumeric(v Value) bool {
+	return v.Type() == VAL_INT || v.Type() == VAL_FLOAT
+}
+
+// isFloatOperation reports whether left and right are both numbers and at
+// least one of them is a float, in which case the int one is promoted.
+func isFloatOperation(left, right Value) bool {
+	return isNumeric(left) && isNumeric(right) && (left.Type() == VAL_FLOAT || right.Type() == VAL_FLOAT)
+}
+
+func asFloat(v Value) float64 {
+	if v.Type() == VAL_INT {
+		return float64(v.Data().(int))
+	}
+	return v.Data().(float64)
+}
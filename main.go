@@ -6,7 +6,10 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/Tinchocw/forky/interpreter"
+	interpreterErrors "github.com/Tinchocw/forky/interpreter/errors"
 	"github.com/peterh/liner"
 )
 
@@ -15,15 +18,33 @@ const DEFAULT_WORKERS = 4
 func main() {
 	// Flags
 	var (
-		debug   bool
-		inject  bool
-		modeStr string
-		workers int
+		debug         bool
+		inject        bool
+		modeStr       string
+		workers       int
+		forkWorkers   int
+		detectRaces   bool
+		deterministic bool
+		seed          int64
+		maxCallDepth  int
+		timeout       time.Duration
+		maxSteps      int64
+		maxArrayCells int
+		maxCells      int
 	)
 
 	flag.BoolVar(&debug, "debug", false, "Enable debug output")
-	flag.StringVar(&modeStr, "mode", "normal", "Run mode: normal, scanning, parsing")
+	flag.StringVar(&modeStr, "mode", "normal", "Run mode: normal, scanning, parsing, resolving")
 	flag.IntVar(&workers, "workers", DEFAULT_WORKERS, "Number of workers for fork-join scanning")
+	flag.IntVar(&forkWorkers, "fork-workers", 0, "Maximum goroutines running fork branches at once, blocked ones aside (default: one per CPU, or one per branch with -deterministic; 0: one per branch)")
+	flag.BoolVar(&detectRaces, "detect-races", false, "Warn about variables and array cells accessed concurrently by fork branches")
+	flag.BoolVar(&deterministic, "deterministic", false, "Run one fork branch at a time, switching between them at statements in an order given by -seed")
+	flag.Int64Var(&seed, "seed", 0, "Seed of the order of fork branches in deterministic mode")
+	flag.IntVar(&maxCallDepth, "max-call-depth", interpreter.DefaultMaxCallDepth, "Maximum nesting of function calls in a branch before a RecursionError")
+	flag.DurationVar(&timeout, "timeout", 0, "Stop a run that takes longer than this, as 2s (0: no timeout)")
+	flag.Int64Var(&maxSteps, "max-steps", 0, "Stop a run after this many statements, loop iterations, calls and fork branches (0: no limit)")
+	flag.IntVar(&maxArrayCells, "max-array-cells", interpreter.DefaultMaxArrayCells, "Maximum cells of an array declaration, counting every dimension, before a MemoryError")
+	flag.IntVar(&maxCells, "max-allocated-cells", 0, "Stop a run that allocates more array cells in all with a MemoryError (0: no limit)")
 	flag.BoolVar(&inject, "inject", false, "Inject input from stdin before REPL")
 	flag.Parse()
 
@@ -34,10 +55,12 @@ func main() {
 		mode = ScanningMode
 	case "parsing":
 		mode = ParsingMode
+	case "resolving":
+		mode = ResolvingMode
 	case "normal":
 		mode = NormalMode
 	default:
-		fmt.Printf("Invalid mode: %s. Valid modes are: normal, scanning, parsing\n", modeStr)
+		fmt.Printf("Invalid mode: %s. Valid modes are: normal, scanning, parsing, resolving\n", modeStr)
 		os.Exit(1)
 	}
 
@@ -45,7 +68,25 @@ func main() {
 		workers = DEFAULT_WORKERS
 	}
 
-	forky := NewForky(workers, debug, mode)
+	var options []interpreter.Option
+	options = append(options, interpreter.WithMaxCallDepth(maxCallDepth))
+	options = append(options, interpreter.WithTimeout(timeout))
+	options = append(options, interpreter.WithMaxSteps(maxSteps))
+	options = append(options, interpreter.WithMaxArrayCells(maxArrayCells))
+	options = append(options, interpreter.WithMaxAllocatedCells(maxCells))
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "fork-workers" {
+			options = append(options, interpreter.WithForkWorkers(forkWorkers))
+		}
+	})
+	if detectRaces {
+		options = append(options, interpreter.WithRaceDetection())
+	}
+	if deterministic {
+		options = append(options, interpreter.WithDeterministicScheduling(seed))
+	}
+
+	forky := NewForky(workers, debug, mode, options...)
 
 	// If a file arg remains, run once on that file
 	if flag.NArg() > 0 {
@@ -64,7 +105,7 @@ func main() {
 
 		_, runErr := forky.Run(f, st.Size())
 		if runErr != nil {
-			fmt.Println(runErr)
+			printError(runErr)
 			os.Exit(1)
 		}
 
@@ -77,6 +118,7 @@ func main() {
 	}
 
 	// REPL mode
+	forky.interactive = true
 	line := liner.NewLiner()
 	defer line.Close()
 
@@ -117,10 +159,55 @@ func main() {
 
 		result, err := forky.Run(strings.NewReader(input), int64(len(input)))
 		if err != nil {
-			fmt.Println(err)
+			printError(err)
 		} else if result != "" {
 			fmt.Println(result)
 		}
 	}
 
 }
+
+// printError prints err, with a traceback for each runtime error in it: one
+// for every failed branch when a fork fails.
+func printError(err error) {
+	runtimeErrs := interpreterErrors.RuntimeErrors(err)
+	if len(runtimeErrs) == 0 {
+		fmt.Println(err)
+		return
+	}
+
+	for i, runtimeErr := range runtimeErrs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(traceback(runtimeErr))
+	}
+}
+
+// traceback renders the calls and fork branches that led to err, outermost
+// first, followed by the error itself. Runs of the same frame, as in a deep
+// recursion, are shown once.
+func traceback(err interpreterErrors.RuntimeError) string {
+	var b strings.Builder
+	if len(err.Frames) > 0 {
+		b.WriteString("Traceback (outermost first):\n")
+	}
+	for i := len(err.Frames) - 1; i >= 0; {
+		frame := err.Frames[i]
+		repeated := 0
+		for i--; i >= 0 && err.Frames[i] == frame; i-- {
+			repeated++
+		}
+
+		fmt.Fprintf(&b, "  %s\n", frame)
+		if repeated > 0 {
+			fmt.Fprintf(&b, "  [the frame above repeated %d more times]\n", repeated)
+		}
+	}
+
+	if err.Located() {
+		fmt.Fprintf(&b, "%s: ", err.Span.Start)
+	}
+	fmt.Fprintf(&b, "%s: %s\n", err.Kind, err.Message)
+	return b.String()
+}
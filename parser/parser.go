@@ -69,6 +69,27 @@ func (p *Parser) match(token common.TokenType) bool {
 	return false
 }
 
+// position returns where the next token starts, or where the input ends.
+func (p *Parser) position() common.Position {
+	if !p.isAtEnd() {
+		return p.peek().Span.Start
+	}
+	if len(p.tokens) > 0 {
+		return p.tokens[len(p.tokens)-1].Span.End
+	}
+	return common.StartPosition()
+}
+
+// spanFrom returns the span from start to the end of the last token read.
+func (p *Parser) spanFrom(start common.Position) common.Span {
+	return common.Span{Start: start, End: p.tokens[p.current-1].Span.End}
+}
+
+// errorf builds a parse error located at the next token.
+func (p *Parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: %s", p.position(), fmt.Sprintf(format, args...))
+}
+
 // return true if all the tokens match sequentially if not, return false and do not consume any token
 func (p *Parser) matchs(token_types ...common.TokenType) bool {
 	if p.checkAll(token_types...) {
@@ -98,7 +119,7 @@ func (p *Parser) program() (statement.Program, error) {
 func (p *Parser) blockStatement() (*block.BlockStatement, error) {
 
 	if !p.match(common.OPEN_BRACES) {
-		return nil, fmt.Errorf("expected '{' at the beginning of block")
+		return nil, p.errorf("expected '{' at the beginning of block")
 	}
 
 	statements := []statement.Statement{}
@@ -111,7 +132,7 @@ func (p *Parser) blockStatement() (*block.BlockStatement, error) {
 	}
 
 	if !p.match(common.CLOSE_BRACES) {
-		return nil, fmt.Errorf("expected '}' at the end of block")
+		return nil, p.errorf("expected '}' at the end of block")
 	}
 
 	return &block.BlockStatement{Statements: statements}, nil
@@ -120,7 +141,7 @@ func (p *Parser) blockStatement() (*block.BlockStatement, error) {
 func (p *Parser) statement() (statement.Statement, error) {
 
 	if p.isAtEnd() {
-		return nil, fmt.Errorf("unexpected end of input")
+		return nil, p.errorf("unexpected end of input")
 	}
 
 	if p.debug {
@@ -133,12 +154,26 @@ func (p *Parser) statement() (statement.Statement, error) {
 	case common.PRINT:
 		return p.printStatement()
 	case common.FORK:
+		if p.checkAll(common.FORK, common.REDUCE) {
+			// A reduction used as an expression.
+			return p.expressionStatement()
+		}
 		return p.forkStatement()
+	case common.LOCK, common.ATOMIC:
+		return p.lockStatement()
+	case common.SELECT:
+		return p.selectStatement()
 	case common.IF:
 		return p.ifStatement()
 	case common.BREAK:
 		return p.breakStatement()
+	case common.CONTINUE:
+		return p.continueStatement()
 	case common.FUNC:
+		if p.checkAll(common.FUNC, common.OPEN_PARENTHESIS) {
+			// An anonymous function used as an expression, e.g. called right away.
+			return p.expressionStatement()
+		}
 		return p.funcStatement()
 	case common.VAR:
 		return p.declarationStatement()
@@ -154,20 +189,21 @@ func (p *Parser) statement() (statement.Statement, error) {
 }
 
 func (p *Parser) printStatement() (*extra.PrintStatement, error) {
+	position := p.position()
 	if !p.match(common.PRINT) {
-		return nil, fmt.Errorf("expected 'print'")
+		return nil, p.errorf("expected 'print'")
 	}
 
 	if !p.match(common.OPEN_PARENTHESIS) {
-		return nil, fmt.Errorf("expected '(' after 'print'")
+		return nil, p.errorf("expected '(' after 'print'")
 	}
 
 	if p.match(common.CLOSE_PARENTHESIS) {
 		if !p.match(common.SEMICOLON) {
-			return nil, fmt.Errorf("expected ';' after print statement")
+			return nil, p.errorf("expected ';' after print statement")
 		}
 
-		return &extra.PrintStatement{}, nil
+		return &extra.PrintStatement{Position: position}, nil
 	}
 
 	expr, err := p.expression()
@@ -176,43 +212,161 @@ func (p *Parser) printStatement() (*extra.PrintStatement, error) {
 	}
 
 	if !p.match(common.CLOSE_PARENTHESIS) {
-		return nil, fmt.Errorf("expected ')' after expression")
+		return nil, p.errorf("expected ')' after expression")
 	}
 
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after print statement")
+		return nil, p.errorf("expected ';' after print statement")
 	}
 
-	return &extra.PrintStatement{Value: expr}, nil
+	return &extra.PrintStatement{Value: expr, Position: position}, nil
 }
 
 func (p *Parser) forkStatement() (extra.ForkStatement, error) {
+	position := p.position()
 	if !p.match(common.FORK) {
-		return nil, fmt.Errorf("expected 'fork'")
+		return nil, p.errorf("expected 'fork'")
 	}
 
 	if p.check(common.OPEN_BRACES) {
-		return p.forkBlockStatement()
+		return p.forkBlockStatement(position)
 	} else {
-		return p.forkArrayStatement()
+		return p.forkArrayStatement(position)
 	}
 }
 
-func (p *Parser) forkBlockStatement() (*extra.ForkBlockStatement, error) {
+func (p *Parser) lockStatement() (*extra.LockStatement, error) {
+	position := p.position()
+
+	var name *string
+	if p.match(common.LOCK) {
+		if !p.check(common.IDENTIFIER) {
+			return nil, p.errorf("expected lock name after 'lock'")
+		}
+		token := p.advance()
+		name = &token.Value
+	} else if !p.match(common.ATOMIC) {
+		return nil, p.errorf("expected 'lock' or 'atomic'")
+	}
+
 	body, err := p.blockStatement()
 	if err != nil {
 		return nil, err
 	}
 
-	return &extra.ForkBlockStatement{Block: body}, nil
+	return &extra.LockStatement{Name: name, Block: body, Position: position}, nil
 }
 
-func (p *Parser) forkArrayStatement() (*extra.ForkArrayStatement, error) {
-	array, err := p.expression()
+func (p *Parser) selectStatement() (*extra.SelectStatement, error) {
+	position := p.position()
+	if !p.match(common.SELECT) {
+		return nil, p.errorf("expected 'select'")
+	}
+	if !p.match(common.OPEN_BRACES) {
+		return nil, p.errorf("expected '{' after 'select'")
+	}
+
+	stmt := &extra.SelectStatement{Position: position}
+	for !p.check(common.CLOSE_BRACES) {
+		switch {
+		case p.check(common.CASE):
+			selectCase, err := p.selectCase()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Cases = append(stmt.Cases, *selectCase)
+		case p.match(common.DEFAULT):
+			if stmt.Default != nil {
+				return nil, p.errorf("select has more than one 'default'")
+			}
+			body, err := p.blockStatement()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Default = body
+		default:
+			return nil, p.errorf("expected 'case', 'default' or '}' in select")
+		}
+	}
+	p.advance()
+
+	if len(stmt.Cases) == 0 {
+		return nil, fmt.Errorf("%s: select needs at least one 'case'", position)
+	}
+	return stmt, nil
+}
+
+// selectCase parses either 'case send(channel, value) { ... }' or
+// 'case receive(channel) name { ... }', where the name is optional.
+func (p *Parser) selectCase() (*extra.SelectCase, error) {
+	position := p.position()
+	if !p.match(common.CASE) {
+		return nil, p.errorf("expected 'case'")
+	}
+
+	if !p.check(common.IDENTIFIER) || (p.peek().Value != "send" && p.peek().Value != "receive") {
+		return nil, p.errorf("expected 'send' or 'receive' after 'case'")
+	}
+	send := p.advance().Value == "send"
+
+	if !p.match(common.OPEN_PARENTHESIS) {
+		return nil, p.errorf("expected '(' after select operation")
+	}
+	channel, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	selectCase := &extra.SelectCase{Channel: channel, Position: position}
+	if send {
+		if !p.match(common.COMMA) {
+			return nil, p.errorf("expected ',' and the value to send")
+		}
+		if selectCase.Value, err = p.expression(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.match(common.CLOSE_PARENTHESIS) {
+		return nil, p.errorf("expected ')' after select operation")
+	}
+
+	if !send && p.check(common.IDENTIFIER) {
+		name := p.advance()
+		selectCase.Name = &name.Value
+	}
+
+	if selectCase.Body, err = p.blockStatement(); err != nil {
+		return nil, err
+	}
+	return selectCase, nil
+}
+
+func (p *Parser) forkBlockStatement(position common.Position) (*extra.ForkBlockStatement, error) {
+	body, err := p.blockStatement()
 	if err != nil {
 		return nil, err
 	}
 
+	return &extra.ForkBlockStatement{Block: body, Position: position}, nil
+}
+
+func (p *Parser) forkArrayStatement(position common.Position) (*extra.ForkArrayStatement, error) {
+	array, indexName, elemName, block, err := p.forkArray()
+	if err != nil {
+		return nil, err
+	}
+
+	return &extra.ForkArrayStatement{Array: array, ElemName: elemName, IndexName: indexName, Block: block, Position: position}, nil
+}
+
+// forkArray parses what follows 'fork' in fork array statements and fork
+// expressions: the array, the optional index and element names, and the body.
+func (p *Parser) forkArray() (expression.Expression, *string, *string, *block.BlockStatement, error) {
+	array, err := p.expression()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
 	// fork array index,elem {
 
 	var elemName *string
@@ -224,7 +378,7 @@ func (p *Parser) forkArrayStatement() (*extra.ForkArrayStatement, error) {
 
 		if p.match(common.COMMA) {
 			if !p.check(common.IDENTIFIER) {
-				return nil, fmt.Errorf("expected identifier after ',' in fork array statement")
+				return nil, nil, nil, nil, p.errorf("expected identifier after ',' in fork array statement")
 			}
 			secondToken := p.advance()
 
@@ -235,19 +389,20 @@ func (p *Parser) forkArrayStatement() (*extra.ForkArrayStatement, error) {
 
 	block, err := p.blockStatement()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	return &extra.ForkArrayStatement{Array: array, ElemName: elemName, IndexName: indexName, Block: block}, nil
+	return array, indexName, elemName, block, nil
 }
 
 func (p *Parser) ifStatement() (*flow.IfStatement, error) {
+	position := p.position()
 	if !p.match(common.IF) {
-		return nil, fmt.Errorf("expected 'if'")
+		return nil, p.errorf("expected 'if'")
 	}
 
 	if !p.match(common.OPEN_PARENTHESIS) {
-		return nil, fmt.Errorf("expected '(' after 'if'")
+		return nil, p.errorf("expected '(' after 'if'")
 	}
 
 	condition, err := p.expression()
@@ -256,7 +411,7 @@ func (p *Parser) ifStatement() (*flow.IfStatement, error) {
 	}
 
 	if !p.match(common.CLOSE_PARENTHESIS) {
-		return nil, fmt.Errorf("expected ')' after if condition")
+		return nil, p.errorf("expected ')' after if condition")
 	}
 
 	body, err := p.blockStatement()
@@ -264,7 +419,7 @@ func (p *Parser) ifStatement() (*flow.IfStatement, error) {
 		return nil, err
 	}
 
-	ifStatement := &flow.IfStatement{Condition: condition, Body: body}
+	ifStatement := &flow.IfStatement{Condition: condition, Body: body, Position: position}
 
 	if p.matchs(common.ELSE, common.IF) {
 		elseIf, err := p.elseIfStatement()
@@ -288,7 +443,7 @@ func (p *Parser) ifStatement() (*flow.IfStatement, error) {
 
 func (p *Parser) elseIfStatement() (*flow.ElseIfStatement, error) {
 	if !p.match(common.OPEN_PARENTHESIS) {
-		return nil, fmt.Errorf("expected '(' after 'else if'")
+		return nil, p.errorf("expected '(' after 'else if'")
 	}
 
 	condition, err := p.expression()
@@ -297,7 +452,7 @@ func (p *Parser) elseIfStatement() (*flow.ElseIfStatement, error) {
 	}
 
 	if !p.match(common.CLOSE_PARENTHESIS) {
-		return nil, fmt.Errorf("expected ')' after else if condition")
+		return nil, p.errorf("expected ')' after else if condition")
 	}
 
 	body, err := p.blockStatement()
@@ -317,22 +472,35 @@ func (p *Parser) elseIfStatement() (*flow.ElseIfStatement, error) {
 }
 
 func (p *Parser) breakStatement() (*flow.BreakStatement, error) {
+	position := p.position()
 	if !p.match(common.BREAK) {
-		return nil, fmt.Errorf("expected 'break'")
+		return nil, p.errorf("expected 'break'")
 	}
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after 'break'")
+		return nil, p.errorf("expected ';' after 'break'")
 	}
-	return &flow.BreakStatement{}, nil
+	return &flow.BreakStatement{Position: position}, nil
+}
+
+func (p *Parser) continueStatement() (*flow.ContinueStatement, error) {
+	position := p.position()
+	if !p.match(common.CONTINUE) {
+		return nil, p.errorf("expected 'continue'")
+	}
+	if !p.match(common.SEMICOLON) {
+		return nil, p.errorf("expected ';' after 'continue'")
+	}
+	return &flow.ContinueStatement{Position: position}, nil
 }
 
 func (p *Parser) returnStatement() (*function.ReturnStatement, error) {
+	position := p.position()
 	if !p.match(common.RETURN) {
-		return nil, fmt.Errorf("expected 'return'")
+		return nil, p.errorf("expected 'return'")
 	}
 
 	if p.match(common.SEMICOLON) {
-		return &function.ReturnStatement{}, nil
+		return &function.ReturnStatement{Position: position}, nil
 	}
 
 	expr, err := p.expression()
@@ -340,42 +508,28 @@ func (p *Parser) returnStatement() (*function.ReturnStatement, error) {
 		return nil, err
 	}
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after 'return'")
+		return nil, p.errorf("expected ';' after 'return'")
 	}
-	return &function.ReturnStatement{Value: expr}, nil
+	return &function.ReturnStatement{Value: expr, Position: position}, nil
 }
 
 func (p *Parser) funcStatement() (*function.FunctionDef, error) {
 	if !p.match(common.FUNC) {
-		return nil, fmt.Errorf("expected 'func'")
+		return nil, p.errorf("expected 'func'")
 	}
 
 	if !p.check(common.IDENTIFIER) {
-		return nil, fmt.Errorf("expected function name after 'func'")
+		return nil, p.errorf("expected function name after 'func'")
 	}
 	name := p.advance()
 
 	if !p.match(common.OPEN_PARENTHESIS) {
-		return nil, fmt.Errorf("expected '(' after function name")
+		return nil, p.errorf("expected '(' after function name")
 	}
 
-	parameters := []string{}
-
-	if !p.match(common.CLOSE_PARENTHESIS) {
-		for {
-			if !p.check(common.IDENTIFIER) {
-				return nil, fmt.Errorf("expected parameter name")
-			}
-			parameters = append(parameters, p.advance().Value)
-
-			if p.match(common.CLOSE_PARENTHESIS) {
-				break
-			}
-
-			if !p.match(common.COMMA) {
-				return nil, fmt.Errorf("expected ',' or ')' after parameter")
-			}
-		}
+	parameters, err := p.parameters()
+	if err != nil {
+		return nil, err
 	}
 
 	body, err := p.blockStatement()
@@ -383,16 +537,42 @@ func (p *Parser) funcStatement() (*function.FunctionDef, error) {
 		return nil, err
 	}
 
-	return &function.FunctionDef{Name: &name.Value, Parameters: parameters, Body: body}, nil
+	return &function.FunctionDef{Name: &name.Value, Parameters: parameters, Body: body, Position: name.Span.Start}, nil
+}
+
+// parameters parses the parameter names of a function up to the closing
+// parenthesis, once the opening one has been consumed.
+func (p *Parser) parameters() ([]string, error) {
+	parameters := []string{}
+
+	if p.match(common.CLOSE_PARENTHESIS) {
+		return parameters, nil
+	}
+
+	for {
+		if !p.check(common.IDENTIFIER) {
+			return nil, p.errorf("expected parameter name")
+		}
+		parameters = append(parameters, p.advance().Value)
+
+		if p.match(common.CLOSE_PARENTHESIS) {
+			return parameters, nil
+		}
+
+		if !p.match(common.COMMA) {
+			return nil, p.errorf("expected ',' or ')' after parameter")
+		}
+	}
 }
 
 func (p *Parser) whileStatement() (*flow.WhileStatement, error) {
+	position := p.position()
 	if !p.match(common.WHILE) {
-		return nil, fmt.Errorf("expected 'while' at the beginning of while statement")
+		return nil, p.errorf("expected 'while' at the beginning of while statement")
 	}
 
 	if !p.match(common.OPEN_PARENTHESIS) {
-		return nil, fmt.Errorf("expected '(' after 'while'")
+		return nil, p.errorf("expected '(' after 'while'")
 	}
 
 	condition, err := p.expression()
@@ -401,7 +581,7 @@ func (p *Parser) whileStatement() (*flow.WhileStatement, error) {
 	}
 
 	if !p.match(common.CLOSE_PARENTHESIS) {
-		return nil, fmt.Errorf("expected ')' after while condition")
+		return nil, p.errorf("expected ')' after while condition")
 	}
 
 	body, err := p.blockStatement()
@@ -409,16 +589,16 @@ func (p *Parser) whileStatement() (*flow.WhileStatement, error) {
 		return nil, err
 	}
 
-	return &flow.WhileStatement{Condition: condition, Body: body}, nil
+	return &flow.WhileStatement{Condition: condition, Body: body, Position: position}, nil
 }
 
 func (p *Parser) assignmentStatement() (assignment.Assignment, error) {
 	if !p.match(common.SET) {
-		return nil, fmt.Errorf("expected 'set' at the beginning of assignment")
+		return nil, p.errorf("expected 'set' at the beginning of assignment")
 	}
 
 	if !p.check(common.IDENTIFIER) {
-		return nil, fmt.Errorf("expected variable name")
+		return nil, p.errorf("expected variable name")
 	}
 
 	name := p.advance()
@@ -436,7 +616,7 @@ func (p *Parser) assignmentStatement() (assignment.Assignment, error) {
 
 func (p *Parser) varAssigmentStatement(name common.Token) (assignment.Assignment, error) {
 	if !p.match(common.EQUAL) {
-		return nil, fmt.Errorf("expected '=' after variable name")
+		return nil, p.errorf("expected '=' after variable name")
 	}
 
 	value, err := p.expression()
@@ -445,10 +625,10 @@ func (p *Parser) varAssigmentStatement(name common.Token) (assignment.Assignment
 	}
 
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after assignment")
+		return nil, p.errorf("expected ';' after assignment")
 	}
 
-	return &assignment.VarAssignment{Name: name.Value, Value: value}, nil
+	return &assignment.VarAssignment{Name: name.Value, Value: value, Position: name.Span.Start}, nil
 }
 
 func (p *Parser) arrayAssignmentStatement(name common.Token) (assignment.Assignment, error) {
@@ -461,12 +641,12 @@ func (p *Parser) arrayAssignmentStatement(name common.Token) (assignment.Assignm
 		}
 		indexes = append(indexes, index)
 		if !p.match(common.CLOSE_BRACKET) {
-			return nil, fmt.Errorf("expected ']' after index expression")
+			return nil, p.errorf("expected ']' after index expression")
 		}
 	}
 
 	if !p.match(common.EQUAL) {
-		return nil, fmt.Errorf("expected '=' after array name and indexes")
+		return nil, p.errorf("expected '=' after array name and indexes")
 	}
 
 	value, err := p.expression()
@@ -475,32 +655,33 @@ func (p *Parser) arrayAssignmentStatement(name common.Token) (assignment.Assignm
 	}
 
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after assignment")
+		return nil, p.errorf("expected ';' after assignment")
 	}
 
-	return &assignment.ArrayAssignment{Name: name.Value, Indexes: indexes, Value: value}, nil
+	return &assignment.ArrayAssignment{Name: name.Value, Indexes: indexes, Value: value, Position: name.Span.Start}, nil
 }
 
 func (p *Parser) expressionStatement() (*statement.ExpressionStatement, error) {
+	position := p.position()
 	expr, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
 
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after expression")
+		return nil, p.errorf("expected ';' after expression")
 	}
 
-	return &statement.ExpressionStatement{Expression: expr}, nil
+	return &statement.ExpressionStatement{Expression: expr, Position: position}, nil
 }
 
 func (p *Parser) declarationStatement() (declaration.DeclarationStatement, error) {
 	if !p.match(common.VAR) {
-		return nil, fmt.Errorf("expected 'var' at the beginning of a declaration")
+		return nil, p.errorf("expected 'var' at the beginning of a declaration")
 	}
 
 	if !p.check(common.IDENTIFIER) {
-		return nil, fmt.Errorf("expected variable name after '%s'", common.VAR_KEYWORD)
+		return nil, p.errorf("expected variable name after '%s'", common.VAR_KEYWORD)
 	}
 
 	name := p.advance()
@@ -523,9 +704,9 @@ func (p *Parser) declarationStatement() (declaration.DeclarationStatement, error
 func (p *Parser) varDeclarationStatement(name common.Token) (*declaration.VarDeclaration, error) {
 	if !p.match(common.EQUAL) {
 		if !p.match(common.SEMICOLON) {
-			return nil, fmt.Errorf("expected '=' or ';' after variable name")
+			return nil, p.errorf("expected '=' or ';' after variable name")
 		}
-		return &declaration.VarDeclaration{Name: name.Value}, nil
+		return &declaration.VarDeclaration{Name: name.Value, Position: name.Span.Start}, nil
 
 	}
 
@@ -535,10 +716,10 @@ func (p *Parser) varDeclarationStatement(name common.Token) (*declaration.VarDec
 	}
 
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after variable declaration")
+		return nil, p.errorf("expected ';' after variable declaration")
 	}
 
-	return &declaration.VarDeclaration{Name: name.Value, Value: value}, nil
+	return &declaration.VarDeclaration{Name: name.Value, Value: value, Position: name.Span.Start}, nil
 }
 
 func (p *Parser) arrayDeclarationStatement(name common.Token) (*declaration.ArrayDeclaration, error) {
@@ -552,16 +733,16 @@ func (p *Parser) arrayDeclarationStatement(name common.Token) (*declaration.Arra
 		lengths = append(lengths, length)
 
 		if !p.match(common.CLOSE_BRACKET) {
-			return nil, fmt.Errorf("expected ']' after size expression")
+			return nil, p.errorf("expected ']' after size expression")
 		}
 	}
 
 	if !p.match(common.EQUAL) {
 		if !p.match(common.SEMICOLON) {
-			return nil, fmt.Errorf("expected '=' or ';' after variable name")
+			return nil, p.errorf("expected '=' or ';' after variable name")
 		}
 
-		return &declaration.ArrayDeclaration{Name: name.Value, Lengths: lengths}, nil
+		return &declaration.ArrayDeclaration{Name: name.Value, Lengths: lengths, Position: name.Span.Start}, nil
 	}
 
 	value, err := p.expression()
@@ -570,10 +751,10 @@ func (p *Parser) arrayDeclarationStatement(name common.Token) (*declaration.Arra
 	}
 
 	if !p.match(common.SEMICOLON) {
-		return nil, fmt.Errorf("expected ';' after variable declaration")
+		return nil, p.errorf("expected ';' after variable declaration")
 	}
 
-	return &declaration.ArrayDeclaration{Name: name.Value, Lengths: lengths, Value: value}, nil
+	return &declaration.ArrayDeclaration{Name: name.Value, Lengths: lengths, Value: value, Position: name.Span.Start}, nil
 }
 
 // EXPRESIONES
@@ -734,6 +915,7 @@ func (p *Parser) unary() (expression.Expression, error) {
 }
 
 func (p *Parser) arrayAccess() (expression.Expression, error) {
+	start := p.position()
 	left, err := p.functionCall()
 	if err != nil {
 		return nil, err
@@ -746,12 +928,13 @@ func (p *Parser) arrayAccess() (expression.Expression, error) {
 		}
 
 		if !p.match(common.CLOSE_BRACKET) {
-			return nil, fmt.Errorf("expected ']' after index expression")
+			return nil, p.errorf("expected ']' after index expression")
 		}
 
 		left = &expression.ArrayAccessNode{
 			Left:  left,
 			Index: index,
+			Span:  p.spanFrom(start),
 		}
 	}
 
@@ -759,6 +942,7 @@ func (p *Parser) arrayAccess() (expression.Expression, error) {
 }
 
 func (p *Parser) functionCall() (expression.Expression, error) {
+	start := p.position()
 	left, err := p.primary()
 	if err != nil {
 		return nil, err
@@ -780,7 +964,7 @@ func (p *Parser) functionCall() (expression.Expression, error) {
 				}
 
 				if !p.match(common.COMMA) {
-					return nil, fmt.Errorf("expected ',' or ')' after function argument")
+					return nil, p.errorf("expected ',' or ')' after function argument")
 				}
 			}
 		}
@@ -788,6 +972,7 @@ func (p *Parser) functionCall() (expression.Expression, error) {
 		left = &expression.FunctionCallNode{
 			Callee:    left,
 			Arguments: args,
+			Span:      p.spanFrom(start),
 		}
 	}
 
@@ -796,7 +981,7 @@ func (p *Parser) functionCall() (expression.Expression, error) {
 
 func (p *Parser) primary() (expression.Primary, error) {
 	if p.isAtEnd() {
-		return nil, fmt.Errorf("unexpected end of input")
+		return nil, p.errorf("unexpected end of input")
 	}
 
 	if p.check(common.FALSE, common.TRUE, common.NONE, common.NUMBER, common.LITERAL) {
@@ -811,7 +996,7 @@ func (p *Parser) primary() (expression.Primary, error) {
 		}
 
 		if !p.match(common.CLOSE_PARENTHESIS) {
-			return nil, fmt.Errorf("expected ')' after expression")
+			return nil, p.errorf("expected ')' after expression")
 		}
 
 		return &expression.GroupingExpressionNode{Expression: expr}, nil
@@ -831,7 +1016,7 @@ func (p *Parser) primary() (expression.Primary, error) {
 					break
 				}
 
-				return nil, fmt.Errorf("expected ',' or ']' after array element")
+				return nil, p.errorf("expected ',' or ']' after array element")
 			}
 		}
 
@@ -843,7 +1028,68 @@ func (p *Parser) primary() (expression.Primary, error) {
 		return &expression.TokenLiteralNode{Token: identifier}, nil
 	}
 
-	return nil, fmt.Errorf("unexpected token: %v", p.peek().String())
+	if p.check(common.FUNC) {
+		position := p.advance().Span.Start
+		if !p.match(common.OPEN_PARENTHESIS) {
+			return nil, p.errorf("expected '(' after 'func'")
+		}
+
+		parameters, err := p.parameters()
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := p.blockStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		return &expression.FunctionLiteralNode{Parameters: parameters, Body: body, Position: position}, nil
+	}
+
+	if p.checkAll(common.FORK, common.REDUCE) {
+		position := p.advance().Span.Start
+		p.advance()
+		return p.forkReduce(position)
+	}
+
+	if p.check(common.FORK) {
+		position := p.advance().Span.Start
+		array, indexName, elemName, body, err := p.forkArray()
+		if err != nil {
+			return nil, err
+		}
+
+		return &expression.ForkExpressionNode{Array: array, IndexName: indexName, ElemName: elemName, Body: body, Position: position}, nil
+	}
+
+	return nil, p.errorf("unexpected token: %v", p.peek().String())
+}
+
+func (p *Parser) forkReduce(position common.Position) (*expression.ForkReduceNode, error) {
+	if !p.match(common.OPEN_PARENTHESIS) {
+		return nil, p.errorf("expected '(' after 'fork reduce'")
+	}
+
+	// fork reduce(array, identity, combine)
+	operands := make([]expression.Expression, 3)
+	for i := range operands {
+		operand, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		operands[i] = operand
+
+		if i < len(operands)-1 && !p.match(common.COMMA) {
+			return nil, p.errorf("expected ',' in fork reduce, which takes an array, an identity and a combining function")
+		}
+	}
+
+	if !p.match(common.CLOSE_PARENTHESIS) {
+		return nil, p.errorf("expected ')' after the combining function of fork reduce")
+	}
+
+	return &expression.ForkReduceNode{Array: operands[0], Identity: operands[1], Combine: operands[2], Position: position}, nil
 }
 
 // END UTILS
@@ -0,0 +1,45 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+// ResolveError is a static error located in the resolved source.
+type ResolveError struct {
+	Position common.Position
+	Message  string
+	// Deferred is set for undefined names used in function bodies. A later
+	// program may still declare them before the function is called, as it
+	// happens in the REPL.
+	Deferred bool
+}
+
+func newResolveError(pos common.Position, message string) *ResolveError {
+	return &ResolveError{Position: pos, Message: message}
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Message)
+}
+
+// ResolveErrors gathers every static error of a program, in source order.
+type ResolveErrors []*ResolveError
+
+func (e ResolveErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e ResolveErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
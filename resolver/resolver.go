@@ -0,0 +1,337 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Tinchocw/forky/common"
+	"github.com/Tinchocw/forky/common/expression"
+	"github.com/Tinchocw/forky/common/statement"
+	"github.com/Tinchocw/forky/common/statement/assignment"
+	"github.com/Tinchocw/forky/common/statement/block"
+	"github.com/Tinchocw/forky/common/statement/declaration"
+	"github.com/Tinchocw/forky/common/statement/extra"
+	"github.com/Tinchocw/forky/common/statement/flow"
+	"github.com/Tinchocw/forky/common/statement/function"
+)
+
+// Binding ties a use of a name to its declaration. Depth is the number of
+// scopes between the scope of the use and the one declaring the name.
+type Binding struct {
+	Name     string
+	Position common.Position
+	Depth    int
+}
+
+type scope struct {
+	names map[string]bool
+	// functions holds the bodies of the functions defined in the scope. They
+	// are resolved when the scope ends, since they may be called once every
+	// name of the scope is declared.
+	functions []func()
+}
+
+// resolution is the state of a single walk over a program.
+type resolution struct {
+	scopes    []*scope
+	loops     int
+	functions int
+	bindings  []Binding
+	errors    ResolveErrors
+	// bodies is the number of function bodies around the code resolved.
+	// Unlike functions, fork branches do not reset it.
+	bodies int
+}
+
+type Resolver struct {
+	debug bool
+}
+
+func CreateResolver(debug bool) *Resolver {
+	return &Resolver{debug: debug}
+}
+
+// Resolve binds every name of program to the scope declaring it before any
+// code runs. scopes are the names defined before the program runs, outermost
+// first: the builtins, then the names defined by the programs already
+// executed, as it happens in the REPL. It reports all the undefined names,
+// duplicate declarations and misplaced break, continue and return as
+// ResolveErrors.
+func (r *Resolver) Resolve(program statement.Program, scopes ...[]string) ([]Binding, error) {
+	res := &resolution{}
+	for _, names := range scopes {
+		res.beginScope()
+		for _, name := range names {
+			res.scopes[len(res.scopes)-1].names[name] = true
+		}
+	}
+	if len(scopes) == 0 {
+		res.beginScope()
+	}
+
+	res.statements(program.Statements)
+	for len(res.scopes) > 0 {
+		res.endScope()
+	}
+
+	sort.SliceStable(res.bindings, func(i, j int) bool {
+		return res.bindings[i].Position.Offset < res.bindings[j].Position.Offset
+	})
+	sort.SliceStable(res.errors, func(i, j int) bool {
+		return res.errors[i].Position.Offset < res.errors[j].Position.Offset
+	})
+
+	if r.debug {
+		fmt.Printf("[DEBUG] Resolved %d bindings with %d errors\n", len(res.bindings), len(res.errors))
+	}
+
+	if len(res.errors) > 0 {
+		return res.bindings, res.errors
+	}
+	return res.bindings, nil
+}
+
+func PrintBindings(bindings []Binding) {
+	fmt.Println()
+	fmt.Printf("%s\n", common.Title("Bindings"))
+
+	for i, binding := range bindings {
+		fmt.Printf("%4d: %-8s %s %s\n", i, binding.Position.String(), common.Colorize(binding.Name, common.COLOR_WHITE), common.Colorize(fmt.Sprintf("depth %d", binding.Depth), common.COLOR_YELLOW))
+	}
+
+	fmt.Printf("%s\n", common.Title("End of Bindings"))
+	fmt.Println()
+}
+
+func (r *resolution) errorf(pos common.Position, format string, args ...any) {
+	r.errors = append(r.errors, newResolveError(pos, fmt.Sprintf(format, args...)))
+}
+
+func (r *resolution) beginScope() {
+	r.scopes = append(r.scopes, &scope{names: map[string]bool{}})
+}
+
+func (r *resolution) endScope() {
+	current := r.scopes[len(r.scopes)-1]
+	for _, body := range current.functions {
+		body()
+	}
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *resolution) declare(name string, pos common.Position) {
+	current := r.scopes[len(r.scopes)-1]
+	if current.names[name] {
+		r.errorf(pos, "'%s' already declared in this scope", name)
+		return
+	}
+	current.names[name] = true
+}
+
+func (r *resolution) use(name string, pos common.Position) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if r.scopes[i].names[name] {
+			r.bindings = append(r.bindings, Binding{Name: name, Position: pos, Depth: len(r.scopes) - 1 - i})
+			return
+		}
+	}
+	err := newResolveError(pos, fmt.Sprintf("undefined name '%s'", name))
+	err.Deferred = r.bodies > 0
+	r.errors = append(r.errors, err)
+}
+
+// function defers the body of a function to the end of the current scope.
+// Calls get a scope of their own for the parameters and the body.
+func (r *resolution) function(parameters []string, body []statement.Statement, pos common.Position) {
+	current := r.scopes[len(r.scopes)-1]
+	current.functions = append(current.functions, func() {
+		loops, functions := r.loops, r.functions
+		r.loops, r.functions = 0, functions+1
+		r.bodies++
+
+		r.beginScope()
+		for _, parameter := range parameters {
+			r.declare(parameter, pos)
+		}
+		r.statements(body)
+		r.endScope()
+
+		r.loops, r.functions = loops, functions
+		r.bodies--
+	})
+}
+
+// branch resolves a fork branch, which runs in a scope of its own. Branches
+// finish on their own, so break, continue and return cannot leave them.
+func (r *resolution) branch(resolve func()) {
+	loops, functions := r.loops, r.functions
+	r.loops, r.functions = 0, 0
+
+	r.beginScope()
+	resolve()
+	r.endScope()
+
+	r.loops, r.functions = loops, functions
+}
+
+// forkArray resolves the branches of a fork over an array. When they give
+// their results, as fork expressions do, they may return.
+func (r *resolution) forkArray(array expression.Expression, indexName *string, elemName *string, body *block.BlockStatement, pos common.Position, returns bool) {
+	r.expression(array)
+	r.branch(func() {
+		if returns {
+			r.functions++
+			defer func() { r.functions-- }()
+		}
+		if indexName != nil {
+			r.declare(*indexName, pos)
+		}
+		if elemName != nil {
+			r.declare(*elemName, pos)
+		}
+		r.block(body)
+	})
+}
+
+func (r *resolution) statements(statements []statement.Statement) {
+	for _, stmt := range statements {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolution) block(b *block.BlockStatement) {
+	r.beginScope()
+	r.statements(b.Statements)
+	r.endScope()
+}
+
+func (r *resolution) statement(stmt statement.Statement) {
+	switch s := stmt.(type) {
+	case *block.BlockStatement:
+		r.block(s)
+	case *declaration.VarDeclaration:
+		r.expression(s.Value)
+		r.declare(s.Name, s.Position)
+	case *declaration.ArrayDeclaration:
+		r.expressions(s.Lengths)
+		r.expression(s.Value)
+		r.declare(s.Name, s.Position)
+	case *assignment.VarAssignment:
+		r.expression(s.Value)
+		r.use(s.Name, s.Position)
+	case *assignment.ArrayAssignment:
+		r.use(s.Name, s.Position)
+		r.expressions(s.Indexes)
+		r.expression(s.Value)
+	case *extra.PrintStatement:
+		r.expression(s.Value)
+	case *extra.ForkBlockStatement:
+		for _, branch := range s.Block.Statements {
+			r.branch(func() {
+				r.statement(branch)
+			})
+		}
+	case *extra.ForkArrayStatement:
+		r.forkArray(s.Array, s.IndexName, s.ElemName, s.Block, s.Position, false)
+	case *extra.LockStatement:
+		r.block(s.Block)
+	case *extra.SelectStatement:
+		for _, c := range s.Cases {
+			r.expression(c.Channel)
+			r.expression(c.Value)
+			r.beginScope()
+			if c.Name != nil {
+				r.declare(*c.Name, c.Position)
+			}
+			r.statements(c.Body.Statements)
+			r.endScope()
+		}
+		if s.Default != nil {
+			r.block(s.Default)
+		}
+	case *flow.IfStatement:
+		r.expression(s.Condition)
+		r.block(s.Body)
+		for elseIf := s.ElseIf; elseIf != nil; elseIf = elseIf.ElseIf {
+			r.expression(elseIf.Condition)
+			r.block(elseIf.Body)
+		}
+		if s.Else != nil {
+			r.block(s.Else.Body)
+		}
+	case *flow.WhileStatement:
+		r.expression(s.Condition)
+		r.loops++
+		r.block(s.Body)
+		r.loops--
+	case *flow.BreakStatement:
+		if r.loops == 0 {
+			r.errorf(s.Position, "'break' outside a loop")
+		}
+	case *flow.ContinueStatement:
+		if r.loops == 0 {
+			r.errorf(s.Position, "'continue' outside a loop")
+		}
+	case *function.FunctionDef:
+		r.declare(*s.Name, s.Position)
+		r.function(s.Parameters, s.Body.Statements, s.Position)
+	case *function.ReturnStatement:
+		if r.functions == 0 {
+			r.errorf(s.Position, "'return' outside a function")
+		}
+		r.expression(s.Value)
+	case *statement.ExpressionStatement:
+		r.expression(s.Expression)
+	}
+}
+
+func (r *resolution) expressions(exprs []expression.Expression) {
+	for _, expr := range exprs {
+		r.expression(expr)
+	}
+}
+
+func (r *resolution) expression(expr expression.Expression) {
+	switch e := expr.(type) {
+	case *expression.LogicalOrNode:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *expression.LogicalAndNode:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *expression.EqualityNode:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *expression.ComparisonNode:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *expression.TermNode:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *expression.FactorNode:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *expression.UnaryNode:
+		r.expression(e.Right)
+	case *expression.ArrayAccessNode:
+		r.expression(e.Left)
+		r.expression(e.Index)
+	case *expression.FunctionCallNode:
+		r.expression(e.Callee)
+		r.expressions(e.Arguments)
+	case *expression.TokenLiteralNode:
+		if e.Token.Typ == common.IDENTIFIER {
+			r.use(e.Token.Value, e.Token.Span.Start)
+		}
+	case *expression.GroupingExpressionNode:
+		r.expression(e.Expression)
+	case *expression.ArrayLiteralNode:
+		r.expressions(e.Elements)
+	case *expression.FunctionLiteralNode:
+		r.function(e.Parameters, e.Body.Statements, e.Position)
+	case *expression.ForkExpressionNode:
+		r.forkArray(e.Array, e.IndexName, e.ElemName, e.Body, e.Position, true)
+	case *expression.ForkReduceNode:
+		r.expressions([]expression.Expression{e.Array, e.Identity, e.Combine})
+	}
+}
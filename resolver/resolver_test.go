@@ -0,0 +1,140 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Tinchocw/forky/parser"
+	"github.com/Tinchocw/forky/scanner"
+)
+
+func resolveSource(t *testing.T, source string) ([]Binding, error) {
+	t.Helper()
+	sc := scanner.CreateForkyScanner(1, false)
+	tokens, err := sc.Scan(strings.NewReader(source), int64(len(source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := parser.CreateForkyParser(1, false)
+	program, err := ps.Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CreateResolver(false).Resolve(program, []string{"print"})
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		errors []string
+	}{
+		{
+			name:   "undefined names, even in branches never taken",
+			source: `var a = b; if (false) { print(c); }`,
+			errors: []string{"1:9: undefined name 'b'", "1:31: undefined name 'c'"},
+		},
+		{
+			name:   "names used before their declaration",
+			source: `print(x); var x = 1;`,
+			errors: []string{"1:7: undefined name 'x'"},
+		},
+		{
+			name:   "duplicate declarations",
+			source: `var x = 1; var x = 2; func f(a, a) { return a; }`,
+			errors: []string{"1:16: 'x' already declared in this scope", "1:28: 'a' already declared in this scope"},
+		},
+		{
+			name:   "declarations shadowing outer scopes",
+			source: `var x = 1; { var x = 2; } func f(x) { var y = x; return y; }`,
+		},
+		{
+			name:   "break and continue outside a loop",
+			source: `break; if (true) { continue; } while (true) { break; }`,
+			errors: []string{"1:1: 'break' outside a loop", "1:20: 'continue' outside a loop"},
+		},
+		{
+			name:   "loops do not reach into the functions they define",
+			source: `while (true) { func f() { break; } }`,
+			errors: []string{"1:27: 'break' outside a loop"},
+		},
+		{
+			name:   "return outside a function",
+			source: `return 1; func f() { while (true) { return 2; } }`,
+			errors: []string{"1:1: 'return' outside a function"},
+		},
+		{
+			name:   "mutually recursive functions",
+			source: `func even(n) { if (n == 0) { return true; } return odd(n - 1); } func odd(n) { if (n == 0) { return false; } return even(n - 1); }`,
+		},
+		{
+			name:   "function bodies see names declared after them",
+			source: `func f() { return later; } var later = 1;`,
+		},
+		{
+			name:   "fork branches declare in scopes of their own",
+			source: `fork { { var x = 1; } { var x = 2; } } fork [1, 2] i, e { var x = i + e; } print(x);`,
+			errors: []string{"1:82: undefined name 'x'"},
+		},
+		{
+			name:   "loops do not reach into fork branches",
+			source: `while (true) { fork [1] e { break; } }`,
+			errors: []string{"1:29: 'break' outside a loop"},
+		},
+		{
+			name:   "functions do not reach into fork branches",
+			source: `func f() { fork { { return 1; } } }`,
+			errors: []string{"1:21: 'return' outside a function"},
+		},
+		{
+			name:   "fork expressions return their results",
+			source: `var squares = fork [1, 2] e { return e * e; };`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := resolveSource(t, test.source)
+			var got []string
+			if err != nil {
+				for _, e := range err.(ResolveErrors) {
+					got = append(got, e.Error())
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(test.errors, "\n") {
+				t.Errorf("got errors %q, want %q", got, test.errors)
+			}
+		})
+	}
+}
+
+func TestResolveBindings(t *testing.T) {
+	bindings, err := resolveSource(t, `var x = 1; func f(y) { { return x + y; } } fork [1] e { print(e); }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	depths := map[string]int{}
+	for _, binding := range bindings {
+		depths[binding.Name] = binding.Depth
+	}
+	// From the block in f: the block, the parameters, then the program.
+	want := map[string]int{"x": 2, "y": 1, "e": 1}
+	for name, depth := range want {
+		if got, ok := depths[name]; !ok || got != depth {
+			t.Errorf("'%s' bound at depth %d, want %d", name, got, depth)
+		}
+	}
+}
+
+func TestDeferredNames(t *testing.T) {
+	_, err := resolveSource(t, `func f() { fork { print(later); } } print(missing);`)
+	errs, _ := err.(ResolveErrors)
+	if len(errs) != 2 {
+		t.Fatalf("got errors %v, want two", err)
+	}
+	// Only function bodies may use names that a later program declares.
+	if !errs[0].Deferred || errs[1].Deferred {
+		t.Errorf("got deferred %v and %v, want true and false", errs[0].Deferred, errs[1].Deferred)
+	}
+}
@@ -0,0 +1,46 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+// ScanError is a lexical error located in the scanned source.
+type ScanError struct {
+	Position common.Position
+	Message  string
+}
+
+func newScanError(pos common.Position, message string) *ScanError {
+	return &ScanError{Position: pos, Message: message}
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Message)
+}
+
+// rebase moves the error from segment-relative coordinates to base-relative ones.
+func (e *ScanError) rebase(base common.Position) *ScanError {
+	return newScanError(e.Position.Rebase(base), e.Message)
+}
+
+// ScanErrors gathers every lexical error of a source, in source order.
+type ScanErrors []*ScanError
+
+func (e ScanErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e ScanErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
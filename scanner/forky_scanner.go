@@ -26,7 +26,7 @@ func parallelScan(r io.ReaderAt, start, end int64, workers int, debug bool) (seg
 	}
 
 	if workers <= 0 || length == 0 {
-		return segment{}, nil
+		return NewSegment(""), nil
 	}
 
 	if workers == 1 || length == 1 {
@@ -40,7 +40,7 @@ func parallelScan(r io.ReaderAt, start, end int64, workers int, debug bool) (seg
 			}
 		}
 		sc := createScanner(string(buf))
-		sg, err := sc.scan()
+		sg := sc.scan()
 		if debug {
 			fmt.Printf("[DEBUG] Sequential scan result: %d tokens\n", len(sg.Tokens))
 			if len(sg.Tokens) > 0 {
@@ -52,7 +52,7 @@ func parallelScan(r io.ReaderAt, start, end int64, workers int, debug bool) (seg
 				fmt.Printf("[DEBUG] Merge capabilities: Start=%v, End=%v\n", sg.CouldMergeStart, sg.CouldMergeEnd)
 			}
 		}
-		return sg, err
+		return sg, nil
 	}
 
 	leftWorkers := (workers + 1) / 2 // ceil(workers/2) ensures left >= right when odd
@@ -147,13 +147,15 @@ func adjustToRuneBoundary(r io.ReaderAt, pos int64) (int64, error) {
 		readByte := make([]byte, 1)
 		r.ReadAt(readByte, i)
 		if utf8.RuneStart(readByte[0]) {
-			return pos, nil
+			return i, nil
 		}
 	}
 
 	return 0, nil
 }
 
+// Scan tokenizes the source. Scanning does not stop at the first lexical
+// error: when there are any, all of them are returned as a ScanErrors.
 func (f *ForkyScanner) Scan(r io.ReaderAt, size int64) ([]common.Token, error) {
 	if f.debug {
 		fmt.Printf("[DEBUG] ========== STARTING FORKY SCAN ==========\n")
@@ -168,12 +170,15 @@ func (f *ForkyScanner) Scan(r io.ReaderAt, size int64) ([]common.Token, error) {
 		}
 		return nil, err
 	}
-	if sg.hasInvalidTokens() {
+	if errs := sg.diagnostics(); len(errs) > 0 {
 		if f.debug {
 			fmt.Printf("[DEBUG] ========== SCAN FAILED ==========\n")
-			fmt.Printf("[DEBUG] Error: merged segment has invalid tokens\n")
+			fmt.Printf("[DEBUG] Errors found: %d\n", len(errs))
+			for _, e := range errs {
+				fmt.Printf("[DEBUG]   %v\n", e)
+			}
 		}
-		return nil, fmt.Errorf("merged segment has invalid tokens")
+		return nil, errs
 	}
 
 	if f.debug {
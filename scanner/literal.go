@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Tinchocw/forky/common"
+)
+
+var simpleEscapes = map[rune]rune{
+	'n':                     '\n',
+	't':                     '\t',
+	common.ESCAPE_SYMBOL:    common.ESCAPE_SYMBOL,
+	common.END_QUOTE_SYMBOL: common.END_QUOTE_SYMBOL,
+}
+
+// literalEnd returns the byte index of the quote that closes a literal whose
+// remaining raw text is text, or -1 when it is not closed there. escaped
+// tells whether the first character is escaped by a preceding backslash.
+func literalEnd(text string, escaped bool) int {
+	for i, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case r == common.ESCAPE_SYMBOL:
+			escaped = true
+		case r == common.END_QUOTE_SYMBOL:
+			return i
+		}
+	}
+	return -1
+}
+
+// pendingEscape reports whether raw literal text ends with a backslash that
+// escapes whatever comes next.
+func pendingEscape(raw string) bool {
+	trailing := len(raw) - len(strings.TrimRight(raw, string(common.ESCAPE_SYMBOL)))
+	return trailing%2 == 1
+}
+
+// decodeLiteral replaces the escape sequences of the raw text of a literal
+// opened at start. Invalid sequences are kept verbatim and reported.
+func decodeLiteral(raw string, start common.Position) (string, []*ScanError) {
+	if !strings.ContainsRune(raw, common.ESCAPE_SYMBOL) {
+		return raw, nil
+	}
+
+	var b strings.Builder
+	var errs []*ScanError
+
+	for i := 0; i < len(raw); {
+		r, size := utf8.DecodeRuneInString(raw[i:])
+		if r != common.ESCAPE_SYMBOL {
+			b.WriteRune(r)
+			i += size
+			continue
+		}
+
+		decoded, length, err := decodeEscape(raw[i:])
+		if err != "" {
+			pos := start.Advance(string(common.START_QUOTE_SYMBOL) + raw[:i])
+			errs = append(errs, newScanError(pos, err))
+		}
+		b.WriteString(decoded)
+		i += length
+	}
+
+	return b.String(), errs
+}
+
+// decodeEscape decodes the escape sequence at the beginning of text. It
+// returns the decoded text, the length of the sequence and an error message.
+func decodeEscape(text string) (string, int, string) {
+	if len(text) < 2 {
+		return text, len(text), "unfinished escape sequence"
+	}
+
+	r, size := utf8.DecodeRuneInString(text[1:])
+	length := 1 + size
+
+	if decoded, ok := simpleEscapes[r]; ok {
+		return string(decoded), length, ""
+	}
+
+	if r != 'u' {
+		return text[:length], length, fmt.Sprintf("invalid escape sequence: %s", text[:length])
+	}
+
+	if !strings.HasPrefix(text[length:], "{") {
+		return text[:length], length, "expected '{' after \\u"
+	}
+
+	closing := strings.IndexRune(text[length:], '}')
+	if closing < 0 {
+		return text[:length], length, "expected '}' to close \\u{"
+	}
+
+	sequence := text[:length+closing+1]
+	digits := text[length+1 : length+closing]
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) == 0 || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+		return sequence, len(sequence), fmt.Sprintf("invalid unicode escape: %s", sequence)
+	}
+
+	return string(rune(code)), len(sequence), ""
+}
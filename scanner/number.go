@@ -0,0 +1,108 @@
+package scanner
+
+import "github.com/Tinchocw/forky/common"
+
+const noNumberTail = -1
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isExponent(b byte) bool {
+	return b == 'e' || b == 'E'
+}
+
+func isSign(b byte) bool {
+	return b == common.PLUS_SYMBOL || b == common.MINUS_SYMBOL
+}
+
+func digitsLength(text string) int {
+	i := 0
+	for i < len(text) && isDigit(text[i]) {
+		i++
+	}
+	return i
+}
+
+func alphanumericLength(text string) int {
+	for i, r := range text {
+		if !common.IsAlphanumeric(r) {
+			return i
+		}
+	}
+	return len(text)
+}
+
+// numberLength returns the length of the number at the start of text: some
+// digits, optionally followed by a fraction and an exponent (42, 3.14, 1e-3).
+func numberLength(text string) int {
+	i := digitsLength(text)
+	if i == 0 {
+		return 0
+	}
+
+	if i+1 < len(text) && text[i] == common.DECIMAL_POINT_SYMBOL && isDigit(text[i+1]) {
+		i += 1 + digitsLength(text[i+1:])
+	}
+
+	if i < len(text) && isExponent(text[i]) {
+		j := i + 1
+		if j < len(text) && isSign(text[j]) {
+			j++
+		}
+		if digits := digitsLength(text[j:]); digits > 0 {
+			i = j + digits
+		}
+	}
+
+	return i
+}
+
+// isNumberPrefix reports whether more input could turn text into a number,
+// as it happens with "3." or "1e-".
+func isNumberPrefix(text string) bool {
+	i := digitsLength(text)
+	if i == 0 {
+		return false
+	}
+
+	if i < len(text) && text[i] == common.DECIMAL_POINT_SYMBOL {
+		if i+1 == len(text) {
+			return true
+		}
+		digits := digitsLength(text[i+1:])
+		if digits == 0 {
+			return false
+		}
+		i += 1 + digits
+	}
+
+	if i < len(text) && isExponent(text[i]) {
+		i++
+		if i < len(text) && isSign(text[i]) {
+			i++
+		}
+		i += digitsLength(text[i:])
+	}
+
+	return i == len(text)
+}
+
+// numberLexeme returns the type and length of the lexeme at the start of
+// text, which begins with a digit. Runs of letters and digits such as 123abc
+// are identifiers unless a number covers them.
+func numberLexeme(text string) (common.TokenType, int) {
+	number := numberLength(text)
+	alphanumeric := alphanumericLength(text)
+
+	if alphanumeric > number {
+		return common.IDENTIFIER, alphanumeric
+	}
+	return common.NUMBER, number
+}
+
+// mayContinue reports whether the lexeme starting at text, which runs until
+// the end of the content, could still grow with the content that follows.
+func mayContinue(text string) bool {
+	return alphanumericLength(text) == len(text) || isNumberPrefix(text)
+}
@@ -10,7 +10,14 @@ import (
 type scanner struct {
 	content       string
 	tokens        []common.Token
+	comments      []common.Span
+	errors        []*ScanError
+	openComment   commentKind
+	numberTail    int
 	index         int
+	line          int
+	column        int
+	start         common.Position
 	canMergeStart bool
 	canMergeEnd   bool
 }
@@ -20,11 +27,20 @@ func createScanner(content string) scanner {
 		content:       content,
 		tokens:        []common.Token{},
 		index:         0,
+		numberTail:    noNumberTail,
+		line:          1,
+		column:        1,
+		start:         common.StartPosition(),
 		canMergeStart: true,
 		canMergeEnd:   true,
 	}
 }
 
+// position returns the current position relative to the start of the content.
+func (s *scanner) position() common.Position {
+	return common.Position{Line: s.line, Column: s.column, Offset: s.index}
+}
+
 func (s *scanner) isAtStart() bool {
 	return s.index == 1 // Is at start if index is 1, as we have already advanced once
 }
@@ -44,6 +60,12 @@ func (s *scanner) lookahead() rune {
 func (s *scanner) advance() rune {
 	r, size := utf8.DecodeRuneInString(s.content[s.index:])
 	s.index += size
+	if r == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
+	}
 	return r
 }
 
@@ -55,7 +77,9 @@ func (s *scanner) match(expected string) bool {
 	}
 
 	if s.content[s.index:s.index+len(expected)] == expected {
-		s.index += len(expected)
+		for range expected {
+			s.advance()
+		}
 		return true
 	}
 
@@ -66,14 +90,58 @@ func (s *scanner) matchRune(expected rune) bool {
 	return s.match(string(expected))
 }
 
-func (s *scanner) addToken(typ common.TokenType) { s.tokens = append(s.tokens, common.NewToken(typ)) }
+func (s *scanner) addToken(typ common.TokenType) { s.addTokenWithValue(typ, "") }
 
 func (s *scanner) addTokenWithValue(typ common.TokenType, value string) {
-	s.tokens = append(s.tokens, common.NewTokenWithValue(typ, value))
+	token := common.NewTokenWithValue(typ, value)
+	token.Span = common.Span{Start: s.start, End: s.position()}
+	s.tokens = append(s.tokens, token)
 }
 
 func (s *scanner) clearTokens() {
 	s.tokens = []common.Token{}
+	s.comments = nil
+	s.errors = nil
+}
+
+func (s *scanner) addComment(open bool) {
+	s.comments = append(s.comments, common.Span{Start: s.start, End: s.position()})
+
+	// A comment works as whitespace between the tokens around it.
+	if s.start.Offset == 0 {
+		s.canMergeStart = false
+	}
+
+	if !open && s.isAtEnd() {
+		s.canMergeEnd = false
+	}
+}
+
+func (s *scanner) addError(message string) {
+	s.errors = append(s.errors, newScanError(s.start, message))
+}
+
+// lineComment consumes a comment whose "//" was already consumed. The
+// comment stays open when the content ends before a newline shows up.
+func (s *scanner) lineComment() {
+	s.consumeWhile(func(r rune) bool { return r != '\n' })
+	if s.isAtEnd() {
+		s.openComment = lineComment
+	}
+	s.addComment(s.isAtEnd())
+}
+
+// blockComment consumes a comment whose "/*" was already consumed.
+func (s *scanner) blockComment() {
+	for !s.match(common.BLOCK_COMMENT_END) {
+		if s.isAtEnd() {
+			s.openComment = blockComment
+			s.addComment(true)
+			return
+		}
+		s.advance()
+	}
+	s.addComment(false)
 }
 
 func (s *scanner) consumeWhile(condition func(rune) bool) {
@@ -82,6 +150,41 @@ func (s *scanner) consumeWhile(condition func(rune) bool) {
 	}
 }
 
+// consumeLiteral consumes the raw text of a literal up to its closing quote,
+// skipping the quotes escaped with a backslash.
+func (s *scanner) consumeLiteral() {
+	escaped := false
+	s.consumeWhile(func(r rune) bool {
+		switch {
+		case escaped:
+			escaped = false
+		case r == common.ESCAPE_SYMBOL:
+			escaped = true
+		case r == common.END_QUOTE_SYMBOL:
+			return false
+		}
+		return true
+	})
+}
+
+// number consumes the lexeme starting with a digit at start, whose first
+// rune was already consumed.
+func (s *scanner) number(start int) {
+	rest := s.content[start:]
+	typ, length := numberLexeme(rest)
+
+	if mayContinue(rest) {
+		// The lexeme reaches the end, so the merge may extend it with the next segment.
+		s.numberTail = start
+	}
+
+	for s.index < start+length {
+		s.advance()
+	}
+
+	s.addTokenWithValue(typ, rest[:length])
+}
+
 func isAllDigits(str string) bool {
 	if len(str) == 0 {
 		return false
@@ -94,8 +197,9 @@ func isAllDigits(str string) bool {
 	return true
 }
 
-func (s *scanner) scan() (segment, error) {
+func (s *scanner) scan() segment {
 	for !s.isAtEnd() {
+		s.start = s.position()
 		r := s.advance()
 
 		if common.IsWhitespace(r) {
@@ -121,7 +225,13 @@ func (s *scanner) scan() (segment, error) {
 			s.addToken(common.ASTERISK)
 
 		case common.SLASH_SYMBOL:
-			s.addToken(common.SLASH)
+			if s.matchRune(common.SLASH_SYMBOL) {
+				s.lineComment()
+			} else if s.matchRune(common.ASTERISK_SYMBOL) {
+				s.blockComment()
+			} else {
+				s.addToken(common.SLASH)
+			}
 
 		case common.COMMA_SYMBOL:
 			s.addToken(common.COMMA)
@@ -181,24 +291,31 @@ func (s *scanner) scan() (segment, error) {
 		case common.START_QUOTE_SYMBOL:
 			start := s.index
 
-			s.consumeWhile(func(r rune) bool { return r != common.END_QUOTE_SYMBOL })
+			s.consumeLiteral()
 			literalStr := s.content[start:s.index]
 
 			if !s.isAtEnd() {
 				s.advance()
-				s.addTokenWithValue(common.LITERAL, literalStr)
+				value, errs := decodeLiteral(literalStr, s.start)
+				s.errors = append(s.errors, errs...)
+				s.addTokenWithValue(common.LITERAL, value)
 			} else {
+				// Kept raw, it is decoded once the merge finds where it ends.
 				s.addTokenWithValue(common.STARTED_LITERAL, literalStr)
 			}
 
 		case common.END_QUOTE_SYMBOL:
+			// The literal was opened in a previous segment, so it spans everything up to here.
 			s.clearTokens()
+			s.start = common.StartPosition()
 			s.addTokenWithValue(common.ENDED_LITERAL, s.content[:s.index-1])
 			s.canMergeStart = true
 
 		default:
 			start := s.index - utf8.RuneLen(r)
-			if common.IsAlphanumeric(r) {
+			if common.IsNumber(r) {
+				s.number(start)
+			} else if common.IsAlphanumeric(r) {
 				s.consumeWhile(common.IsAlphanumeric)
 				lexeme := s.content[start:s.index]
 
@@ -214,7 +331,17 @@ func (s *scanner) scan() (segment, error) {
 
 				s.addTokenWithValue(common.IDENTIFIER, lexeme)
 			} else {
-				return segment{}, fmt.Errorf("unexpected character: %c (%d)", r, r)
+				// Reported once the merge knows this is not part of a literal or a
+				// comment opened in a previous segment.
+				s.addError(fmt.Sprintf("unexpected character: %c (%d)", r, r))
+
+				if s.start.Offset == 0 {
+					s.canMergeStart = false
+				}
+
+				if s.isAtEnd() {
+					s.canMergeEnd = false
+				}
 			}
 		}
 	}
@@ -223,6 +350,11 @@ func (s *scanner) scan() (segment, error) {
 		CouldMergeStart: s.canMergeStart,
 		CouldMergeEnd:   s.canMergeEnd,
 		Tokens:          s.tokens,
+		Comments:        s.comments,
+		Errors:          s.errors,
+		OpenComment:     s.openComment,
+		numberTail:      s.numberTail,
 		Content:         s.content,
-	}, nil
+		End:             s.position(),
+	}
 }
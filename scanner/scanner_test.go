@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/Tinchocw/forky/common"
@@ -127,3 +128,165 @@ func TestCrossBoundaryOperators(t *testing.T) {
 	}
 	checkTokens(t, toks, expected)
 }
+
+func TestTokenSpans(t *testing.T) {
+	input := "var answer = 42;\nif (answer == 42) {\n  print(\"mañana\nsí');\n}"
+	reference, err := ScanString(input, 1)
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	literal := reference[14]
+	if literal.Typ != common.LITERAL {
+		t.Fatalf("expected LITERAL at index 14, got %s", literal.Typ)
+	}
+	start := common.Position{Line: 3, Column: 9, Offset: 45}
+	end := common.Position{Line: 4, Column: 4, Offset: 58}
+	if literal.Span.Start != start || literal.Span.End != end {
+		t.Fatalf("literal span mismatch: got %v-%v expected %v-%v", literal.Span.Start, literal.Span.End, start, end)
+	}
+
+	for w := 2; w <= len(input); w++ {
+		toks, err := ScanString(input, w)
+		if err != nil {
+			t.Fatalf("scan error workers=%d: %v", w, err)
+		}
+		if len(toks) != len(reference) {
+			t.Fatalf("token length mismatch workers=%d: got %d expected %d", w, len(toks), len(reference))
+		}
+		for i := range reference {
+			if toks[i] != reference[i] {
+				t.Fatalf("token %d mismatch workers=%d: got %s %v expected %s %v", i, w, toks[i], toks[i].Span, reference[i], reference[i].Span)
+			}
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected []expectedToken
+	}{
+		{"a // what's \"this? /*\nb", []expectedToken{{common.IDENTIFIER, "a"}, {common.IDENTIFIER, "b"}}},
+		{"x /* it's ? // \"odd\n */ y", []expectedToken{{common.IDENTIFIER, "x"}, {common.IDENTIFIER, "y"}}},
+		{"a/**/b//c", []expectedToken{{common.IDENTIFIER, "a"}, {common.IDENTIFIER, "b"}}},
+		{"/*/ still a comment */ ok", []expectedToken{{common.IDENTIFIER, "ok"}}},
+		{"\"http://x.com/*' / 2 // done", []expectedToken{{common.LITERAL, "http://x.com/*"}, {common.SLASH, ""}, {common.NUMBER, "2"}}},
+		{"set x = 1; // one\n/* two\n*/ set y=x/2;", []expectedToken{
+			{common.SET, ""}, {common.IDENTIFIER, "x"}, {common.EQUAL, ""}, {common.NUMBER, "1"}, {common.SEMICOLON, ""},
+			{common.SET, ""}, {common.IDENTIFIER, "y"}, {common.EQUAL, ""}, {common.IDENTIFIER, "x"}, {common.SLASH, ""}, {common.NUMBER, "2"}, {common.SEMICOLON, ""},
+		}},
+	}
+
+	for _, c := range cases {
+		reference, err := ScanString(c.input, 1)
+		if err != nil {
+			t.Fatalf("scan error for %q: %v", c.input, err)
+		}
+		checkTokens(t, reference, c.expected)
+
+		for w := 2; w <= len(c.input); w++ {
+			toks, err := ScanString(c.input, w)
+			if err != nil {
+				t.Fatalf("scan error for %q workers=%d: %v", c.input, w, err)
+			}
+			if len(toks) != len(reference) {
+				t.Fatalf("token length mismatch for %q workers=%d: got %v expected %v", c.input, w, toks, reference)
+			}
+			for i := range reference {
+				if toks[i] != reference[i] {
+					t.Fatalf("token %d mismatch for %q workers=%d: got %s %v expected %s %v", i, c.input, w, toks[i], toks[i].Span, reference[i], reference[i].Span)
+				}
+			}
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := "a /* never closed"
+	for w := 1; w <= len(input); w++ {
+		if _, err := ScanString(input, w); err == nil {
+			t.Fatalf("expected error for unterminated block comment workers=%d, got none", w)
+		}
+	}
+}
+
+func TestAllLexicalErrorsReported(t *testing.T) {
+	input := "var a = 1 ? 2;\nset b = a $ 3; \"ok' /* ?? */\nprint(\"unterminated"
+	expected := []string{
+		"1:11: unexpected character: ? (63)",
+		"2:11: unexpected character: $ (36)",
+		"3:7: unterminated string literal",
+	}
+
+	for w := 1; w <= len(input); w++ {
+		_, err := ScanString(input, w)
+		var errs ScanErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("expected ScanErrors workers=%d, got %v", w, err)
+		}
+		if len(errs) != len(expected) {
+			t.Fatalf("error count mismatch workers=%d: got %d expected %d\nGot: %v", w, len(errs), len(expected), errs)
+		}
+		for i, e := range expected {
+			if errs[i].Error() != e {
+				t.Fatalf("error %d mismatch workers=%d: got %q expected %q", i, w, errs[i].Error(), e)
+			}
+		}
+	}
+}
+
+func TestLiteralEscapes(t *testing.T) {
+	input := `"it\'s a\tb\nc \\ \u{1F600}!' x`
+	expected := []expectedToken{{common.LITERAL, "it's a\tb\nc \\ 😀!"}, {common.IDENTIFIER, "x"}}
+	for w := 1; w <= len(input); w++ {
+		toks, err := ScanString(input, w)
+		if err != nil {
+			t.Fatalf("scan error workers=%d: %v", w, err)
+		}
+		checkTokens(t, toks, expected)
+	}
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	input := "\"bad \\q and \\u{110000}'"
+	expected := []string{
+		"1:6: invalid escape sequence: \\q",
+		"1:13: invalid unicode escape: \\u{110000}",
+	}
+	for w := 1; w <= len(input); w++ {
+		_, err := ScanString(input, w)
+		var errs ScanErrors
+		if !errors.As(err, &errs) || len(errs) != len(expected) {
+			t.Fatalf("expected %d errors workers=%d, got %v", len(expected), w, err)
+		}
+		for i, e := range expected {
+			if errs[i].Error() != e {
+				t.Fatalf("error %d mismatch workers=%d: got %q expected %q", i, w, errs[i].Error(), e)
+			}
+		}
+	}
+}
+
+func TestFloatNumbers(t *testing.T) {
+	input := "3.14 1e-3 2.5E+10 12abc 7"
+	expected := []expectedToken{
+		{common.NUMBER, "3.14"}, {common.NUMBER, "1e-3"}, {common.NUMBER, "2.5E+10"},
+		{common.IDENTIFIER, "12abc"}, {common.NUMBER, "7"},
+	}
+	for w := 1; w <= len(input); w++ {
+		toks, err := ScanString(input, w)
+		if err != nil {
+			t.Fatalf("scan error workers=%d: %v", w, err)
+		}
+		checkTokens(t, toks, expected)
+	}
+
+	input = "x = 7.y"
+	for w := 1; w <= len(input); w++ {
+		_, err := ScanString(input, w)
+		if err == nil || err.Error() != "1:6: unexpected character: . (46)" {
+			t.Fatalf("workers=%d: expected error for the stray '.', got %v", w, err)
+		}
+	}
+}
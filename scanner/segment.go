@@ -2,15 +2,34 @@ package scanner
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/Tinchocw/forky/common"
 )
 
+type commentKind int
+
+const (
+	noComment commentKind = iota
+	lineComment
+	blockComment
+)
+
+// segment holds the tokens scanned from a contiguous chunk of the source.
+// Token, comment and error positions, as well as End, are relative to the
+// start of the chunk.
 type segment struct {
 	CouldMergeStart bool
 	CouldMergeEnd   bool
 	Tokens          []common.Token
+	Comments        []common.Span
+	Errors          []*ScanError
+	OpenComment     commentKind // kind of the last comment when it is still open at the end
 	Content         string
+	End             common.Position
+	numberTail      int // offset of a lexeme starting with a digit that may continue in the next segment
 }
 
 func NewSegment(content string) segment {
@@ -19,6 +38,8 @@ func NewSegment(content string) segment {
 		CouldMergeEnd:   true,
 		Tokens:          []common.Token{},
 		Content:         content,
+		End:             common.StartPosition().Advance(content),
+		numberTail:      noNumberTail,
 	}
 }
 
@@ -40,20 +61,27 @@ func (s *segment) AddTokens(tokens []common.Token) {
 	s.Tokens = append(s.Tokens, tokens...)
 }
 
-func (s *segment) hasInvalidTokens() bool {
-	if !s.hasTokens() {
-		return false
+// diagnostics returns every lexical error of a fully merged segment, that
+// is, one holding the whole source, sorted by position.
+func (s *segment) diagnostics() ScanErrors {
+	errs := ScanErrors(slices.Clone(s.Errors))
+
+	if s.hasTokens() && s.firstToken().Typ == common.ENDED_LITERAL {
+		end := s.firstToken().Span.End
+		quote := common.Position{Line: end.Line, Column: end.Column - 1, Offset: end.Offset - utf8.RuneLen(common.END_QUOTE_SYMBOL)}
+		errs = append(errs, newScanError(quote, fmt.Sprintf("unexpected %c without an opening %c", common.END_QUOTE_SYMBOL, common.START_QUOTE_SYMBOL)))
 	}
 
-	if s.firstToken().Typ == common.ENDED_LITERAL {
-		return true
+	if s.hasTokens() && s.lastToken().Typ == common.STARTED_LITERAL {
+		errs = append(errs, newScanError(s.lastToken().Span.Start, "unterminated string literal"))
 	}
 
-	if s.lastToken().Typ == common.STARTED_LITERAL {
-		return true
+	if s.OpenComment == blockComment {
+		errs = append(errs, newScanError(s.Comments[len(s.Comments)-1].Start, "unterminated block comment"))
 	}
 
-	return false
+	slices.SortStableFunc(errs, func(a, b *ScanError) int { return a.Position.Offset - b.Position.Offset })
+	return errs
 }
 
 func (s *segment) hasTokens() bool {
@@ -92,15 +120,343 @@ func (s *segment) clearTokens() {
 	s.Tokens = []common.Token{}
 }
 
+// glueTokens appends the text of next, which was scanned right after dst, to dst.
+func glueTokens(dst *common.Token, next common.Token) {
+	dst.Value += next.Value
+	dst.Span.End = next.Span.End
+}
+
+// rebase moves everything located in the segment so that it is relative to base.
+func (s *segment) rebase(base common.Position) {
+	for i := range s.Tokens {
+		s.Tokens[i].Span = s.Tokens[i].Span.Rebase(base)
+	}
+	for i := range s.Comments {
+		s.Comments[i] = s.Comments[i].Rebase(base)
+	}
+	for i, err := range s.Errors {
+		s.Errors[i] = err.rebase(base)
+	}
+	if s.numberTail != noNumberTail {
+		s.numberTail += base.Offset
+	}
+}
+
+func (s *segment) clearAll() {
+	s.clearTokens()
+	s.Comments = nil
+	s.Errors = nil
+}
+
+// dropBefore discards the tokens, comments and errors that start before offset.
+func (s *segment) dropBefore(offset int) {
+	tokens := 0
+	for tokens < len(s.Tokens) && s.Tokens[tokens].Span.Start.Offset < offset {
+		tokens++
+	}
+	s.Tokens = s.Tokens[tokens:]
+
+	comments := 0
+	for comments < len(s.Comments) && s.Comments[comments].Start.Offset < offset {
+		comments++
+	}
+	s.Comments = s.Comments[comments:]
+
+	errs := 0
+	for errs < len(s.Errors) && s.Errors[errs].Position.Offset < offset {
+		errs++
+	}
+	s.Errors = s.Errors[errs:]
+}
+
+// isBoundary reports whether the scanner crossed offset between two lexemes,
+// that is, in its default state. Only then are the tokens after it reliable.
+func (s *segment) isBoundary(offset int) bool {
+	for _, token := range s.Tokens {
+		if token.Span.Start.Offset >= offset {
+			break
+		}
+		if token.Span.End.Offset > offset {
+			return false
+		}
+	}
+	for _, comment := range s.Comments {
+		if comment.Start.Offset >= offset {
+			break
+		}
+		if comment.End.Offset > offset {
+			return false
+		}
+	}
+	return true
+}
+
+// resync makes other describe only what follows its byte k, where a
+// construct left open by the previous segment ends. When the scanner of
+// other was in the middle of a lexeme at k, the rest is scanned again.
+func (other *segment) resync(k int, base common.Position) {
+	at := common.StartPosition().Advance(other.Content[:k]).Rebase(base)
+
+	if k == len(other.Content) {
+		other.clearAll()
+		other.OpenComment = noComment
+		other.numberTail = noNumberTail
+		other.CouldMergeEnd = false
+		return
+	}
+
+	if other.isBoundary(at.Offset) {
+		other.dropBefore(at.Offset)
+		return
+	}
+
+	sc := createScanner(other.Content[k:])
+	rest := sc.scan()
+	rest.rebase(at)
+
+	other.Tokens = rest.Tokens
+	other.Comments = rest.Comments
+	other.Errors = rest.Errors
+	other.OpenComment = rest.OpenComment
+	other.numberTail = rest.numberTail
+	other.CouldMergeEnd = rest.CouldMergeEnd
+}
+
+// opensCommentWith reports whether current ends with a '/' that, together
+// with the first character of other, starts a comment.
+func (current *segment) opensCommentWith(other *segment) bool {
+	if current.OpenComment != noComment || !current.hasTokens() {
+		return false
+	}
+
+	last := current.lastToken()
+	if last.Typ != common.SLASH || last.Span.End.Offset != current.End.Offset {
+		return false
+	}
+
+	return strings.HasPrefix(other.Content, string(common.SLASH_SYMBOL)) ||
+		strings.HasPrefix(other.Content, string(common.ASTERISK_SYMBOL))
+}
+
+// continueComment extends the comment left open by current into other.
+// It returns true when the comment ends inside other.
+func (current *segment) continueComment(other *segment, from int) bool {
+	comment := &current.Comments[len(current.Comments)-1]
+	k := -1
+
+	switch current.OpenComment {
+	case lineComment:
+		if idx := strings.IndexRune(other.Content[from:], '\n'); idx >= 0 {
+			k = from + idx
+		}
+	case blockComment:
+		pendingStar := from == 0 && len(current.Content)-1 >= comment.Start.Offset+2 &&
+			strings.HasSuffix(current.Content, string(common.ASTERISK_SYMBOL))
+		if pendingStar && strings.HasPrefix(other.Content, string(common.SLASH_SYMBOL)) {
+			k = 1
+		} else if idx := strings.Index(other.Content[from:], common.BLOCK_COMMENT_END); idx >= 0 {
+			k = from + idx + len(common.BLOCK_COMMENT_END)
+		}
+	}
+
+	if k < 0 {
+		comment.End = other.End.Rebase(current.End)
+		other.clearAll()
+		other.OpenComment = current.OpenComment
+		return false
+	}
+
+	comment.End = common.StartPosition().Advance(other.Content[:k]).Rebase(current.End)
+	current.OpenComment = noComment
+	other.resync(k, current.End)
+	return true
+}
+
+// continueLiteral extends the STARTED_LITERAL that ends current into other.
+// It returns true when the literal is closed inside other.
+func (current *segment) continueLiteral(other *segment) bool {
+	literal := current.lastToken()
+	idx := literalEnd(other.Content, pendingEscape(literal.Value))
+
+	if idx < 0 {
+		literal.Value += other.Content
+		literal.Span.End = other.End.Rebase(current.End)
+		other.clearAll()
+		other.OpenComment = noComment
+		return false
+	}
+
+	k := idx + utf8.RuneLen(common.END_QUOTE_SYMBOL)
+	value, errs := decodeLiteral(literal.Value+other.Content[:idx], literal.Span.Start)
+	current.Errors = append(current.Errors, errs...)
+	literal.Typ = common.LITERAL
+	literal.Value = value
+	literal.Span.End = common.StartPosition().Advance(other.Content[:k]).Rebase(current.End)
+	other.resync(k, current.End)
+	return true
+}
+
+// continueNumber lexes again the lexeme starting with a digit that runs
+// until the end of current, now that other tells how it goes on. It returns
+// whether anything of other is left.
+func (current *segment) continueNumber(other *segment) bool {
+	tail := current.Content[current.numberTail:]
+	text := tail + other.Content
+	typ, length := numberLexeme(text)
+
+	k := length - len(tail)
+	if k <= 0 {
+		if mayContinue(text) {
+			// As in 1 followed by '.', other only holds the rest of a prefix.
+			other.numberTail = current.numberTail
+		}
+		// Only what follows the number, as the e of 1.5e, may glue with other.
+		current.CouldMergeEnd = current.CouldMergeEnd && current.lastToken().Span.Start.Offset > current.numberTail
+		return true
+	}
+
+	i := len(current.Tokens)
+	for i > 0 && current.Tokens[i-1].Span.Start.Offset >= current.numberTail {
+		i--
+	}
+	start := current.Tokens[i].Span.Start
+	current.Tokens = current.Tokens[:i]
+
+	errs := len(current.Errors)
+	for errs > 0 && current.Errors[errs-1].Position.Offset >= current.numberTail {
+		errs--
+	}
+	current.Errors = current.Errors[:errs]
+
+	current.AddTokens([]common.Token{{
+		Typ:   typ,
+		Value: text[:length],
+		Span:  common.Span{Start: start, End: start.Advance(text[:length])},
+	}})
+	if k == len(other.Content) {
+		// The lexeme still runs until the end, so it may glue with what follows.
+		current.CouldMergeEnd = true
+		other.clearAll()
+		other.numberTail = current.numberTail
+		return false
+	}
+
+	current.CouldMergeEnd = false
+
+	other.resync(k, current.End)
+	if mayContinue(text) {
+		other.numberTail = current.numberTail
+	} else if other.numberTail < current.End.Offset+k {
+		// What other took for the start of a number is part of the lexeme above.
+		other.numberTail = noNumberTail
+	}
+	return true
+}
+
+// continueOpenConstruct stitches a comment or literal still open at the end
+// of current with other. It returns false when the construct swallows all of
+// other, so nothing else is left to merge.
+func (current *segment) continueOpenConstruct(other *segment) bool {
+	from := 0
+	if current.opensCommentWith(other) {
+		slash := current.Tokens[len(current.Tokens)-1]
+		current.Tokens = current.Tokens[:len(current.Tokens)-1]
+		current.Comments = append(current.Comments, slash.Span)
+		if slash.Span.Start.Offset == 0 {
+			current.CouldMergeStart = false
+		}
+		current.OpenComment = lineComment
+		if other.Content[0] == common.ASTERISK_SYMBOL {
+			current.OpenComment = blockComment
+		}
+		from = 1
+	}
+
+	if current.OpenComment != noComment {
+		if !current.continueComment(other, from) {
+			return false
+		}
+	} else if current.hasTokens() && current.lastToken().Typ == common.STARTED_LITERAL {
+		if !current.continueLiteral(other) {
+			return false
+		}
+	} else if current.numberTail != noNumberTail {
+		return current.continueNumber(other)
+	} else {
+		return true
+	}
+
+	// The construct separates the tokens at both of its sides.
+	current.CouldMergeEnd = false
+	return true
+}
+
+// glueAlphanumeric appends to the identifier ending current the letters and
+// digits other starts with. Those are all an identifier can take from a
+// number such as 1.5, whose remainder is lexed again.
+func (current *segment) glueAlphanumeric(other *segment) {
+	last := current.lastToken()
+	k := alphanumericLength(other.Content)
+
+	if other.firstToken().Span.End.Offset-current.End.Offset == k {
+		glueTokens(last, other.consumeOne())
+		return
+	}
+
+	last.Value += other.Content[:k]
+	last.Span.End = last.Span.End.Advance(other.Content[:k])
+	other.resync(k, current.End)
+}
+
+// equalCompounds maps the operators that can be followed by '=' to the
+// operator they form together.
+var equalCompounds = map[common.TokenType]common.TokenType{
+	common.EQUAL:   common.EQUAL_EQUAL,
+	common.BANG:    common.BANG_EQUAL,
+	common.LESS:    common.LESS_EQUAL,
+	common.GREATER: common.GREATER_EQUAL,
+}
+
+// glueEqualSign completes the operator that ends current with the '=' other starts with.
+func (current *segment) glueEqualSign(other *segment) {
+	last := current.lastToken()
+
+	switch other.firstToken().Typ {
+	case common.EQUAL:
+		last.Typ = equalCompounds[last.Typ]
+		last.Span.End = other.consumeOne().Span.End
+	case common.EQUAL_EQUAL:
+		// Only the first '=' belongs to the operator, the second one starts a new lexeme.
+		last.Typ = equalCompounds[last.Typ]
+		last.Span.End = last.Span.End.Advance(string(common.EQUAL_SYMBOL))
+		other.resync(1, current.End)
+	}
+}
+
 func (current *segment) Merge(other *segment) {
+	if len(other.Content) == 0 {
+		return
+	}
+
+	base := current.End
+	otherEnd := other.End.Rebase(base)
+	other.rebase(base)
+
 	defer func() {
+		current.Comments = append(current.Comments, other.Comments...)
+		current.Errors = append(current.Errors, other.Errors...)
+		current.OpenComment = other.OpenComment
+		current.numberTail = other.numberTail
 		current.Content += other.Content
+		current.End = otherEnd
 	}()
 
+	if !current.continueOpenConstruct(other) {
+		return
+	}
+
 	if !other.hasTokens() {
-		if len(other.Content) > 0 {
-			current.CouldMergeEnd = other.CouldMergeEnd
-		}
+		current.CouldMergeEnd = other.CouldMergeEnd
 
 		if len(current.Content) == 0 {
 			current.CouldMergeStart = other.CouldMergeStart
@@ -109,20 +465,17 @@ func (current *segment) Merge(other *segment) {
 	}
 
 	if other.firstToken().Typ == common.ENDED_LITERAL {
-		if current.CouldMergeEnd && current.hasTokens() && current.lastToken().Typ == common.STARTED_LITERAL {
-			current.lastToken().Typ = common.LITERAL
-			current.lastToken().Value += other.consumeOne().Value
-		} else {
-			other.firstToken().Value = current.Content + other.firstToken().Value
-			current.clearTokens()
-		}
+		// The literal was opened before current, so everything up to the quote belongs to it.
+		ended := other.firstToken()
+		ended.Value = (current.Content + other.Content)[:ended.Span.End.Offset-utf8.RuneLen(common.END_QUOTE_SYMBOL)]
+		ended.Span.Start = common.StartPosition()
+		current.clearAll()
 
 		current.AddTokens(other.Tokens)
 		current.CouldMergeStart = true
 		current.CouldMergeEnd = other.CouldMergeEnd
 		return
 	}
-
 	if !current.CouldMergeEnd || !current.hasTokens() {
 		current.Tokens = append(current.Tokens, other.Tokens...)
 		if len(current.Content) == 0 {
@@ -135,35 +488,17 @@ func (current *segment) Merge(other *segment) {
 
 	if other.CouldMergeStart {
 		switch current.lastToken().Typ {
-		case common.EQUAL:
-			if other.firstToken().Typ == common.EQUAL {
-				current.lastToken().Typ = common.EQUAL_EQUAL
-				other.consumeOne()
-			}
-		case common.BANG:
-			if other.firstToken().Typ == common.EQUAL {
-				current.lastToken().Typ = common.BANG_EQUAL
-				other.consumeOne()
-			}
-		case common.LESS:
-			if other.firstToken().Typ == common.EQUAL {
-				current.lastToken().Typ = common.LESS_EQUAL
-				other.consumeOne()
-			}
-		case common.GREATER:
-			if other.firstToken().Typ == common.EQUAL {
-				current.lastToken().Typ = common.GREATER_EQUAL
-				other.consumeOne()
-			}
+		case common.EQUAL, common.BANG, common.LESS, common.GREATER:
+			current.glueEqualSign(other)
 		case common.NUMBER, common.IDENTIFIER:
 			if other.firstToken().Typ == common.NUMBER || other.firstToken().Typ == common.IDENTIFIER {
 				if other.firstToken().Typ != current.lastToken().Typ {
 					current.lastToken().Typ = common.IDENTIFIER
 				}
 
-				current.lastToken().Value += other.consumeOne().Value
+				current.glueAlphanumeric(other)
 			} else if keyword, ok := common.KEYWORDS_VALUES[other.firstToken().Typ]; ok {
-				other.consumeOne()
+				current.lastToken().Span.End = other.consumeOne().Span.End
 				current.lastToken().Value += keyword
 			}
 		}
@@ -171,9 +506,10 @@ func (current *segment) Merge(other *segment) {
 		if currentKeyword, ok := common.KEYWORDS_VALUES[current.lastToken().Typ]; ok {
 			if other.firstToken().Typ == common.NUMBER || other.firstToken().Typ == common.IDENTIFIER {
 				current.lastToken().Typ = common.IDENTIFIER
-				current.lastToken().Value = currentKeyword + other.consumeOne().Value
+				current.lastToken().Value = currentKeyword
+				current.glueAlphanumeric(other)
 			} else if otherKeyword, ok := common.KEYWORDS_VALUES[other.firstToken().Typ]; ok {
-				other.consumeOne()
+				current.lastToken().Span.End = other.consumeOne().Span.End
 				current.lastToken().Typ = common.IDENTIFIER
 				current.lastToken().Value = currentKeyword + otherKeyword
 			}
@@ -187,14 +523,10 @@ func (current *segment) Merge(other *segment) {
 				current.lastToken().Typ = keywordType
 			}
 		}
-	}
 
-	if current.lastToken().Typ == common.STARTED_LITERAL {
-		if other.firstToken().Typ == common.ENDED_LITERAL {
-			current.firstToken().Value += other.consumeOne().Value
-		} else {
-			current.Tokens[len(current.Tokens)-1].Value += other.Content
-			other.clearTokens()
+		// A lexeme glued to an identifier is no longer the start of a number.
+		if other.numberTail != noNumberTail && (!other.hasTokens() || other.firstToken().Span.Start.Offset > other.numberTail) {
+			other.numberTail = noNumberTail
 		}
 	}
 